@@ -0,0 +1,131 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+type requestLogKey struct{}
+
+// requestLog collects what a request did for its access log entry.
+type requestLog struct {
+	// id is also logged with each registry request made on the request's
+	// behalf, so they can be tied back to it.
+	id               string
+	registryRequests atomic.Int64
+
+	mu sync.Mutex
+	// outcome is the category of the first lookup that failed, if any.
+	outcome string
+}
+
+func requestLogFrom(ctx context.Context) *requestLog {
+	l, _ := ctx.Value(requestLogKey{}).(*requestLog)
+	return l
+}
+
+// recordOutcome notes the outcome of a lookup made by the request in ctx.
+func recordOutcome(ctx context.Context, outcome string) {
+	l := requestLogFrom(ctx)
+	if l == nil || outcome == outcomeSuccess {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.outcome == "" {
+		l.outcome = outcome
+	}
+}
+
+// statusRecorder captures the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (w *statusRecorder) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush passes through to the underlying writer, so that streamed responses
+// (e.g. raw=manifest) keep streaming.
+func (w *statusRecorder) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// logRequests writes an access log entry for every request h serves, other
+// than probes and favicons which would only drown everything else out.
+func logRequests(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" || r.URL.Path == "/readyz" || strings.HasPrefix(r.URL.Path, "/favicon") {
+			h.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		l := &requestLog{id: newRequestID()}
+		rec := &statusRecorder{ResponseWriter: w}
+		h.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), requestLogKey{}, l)))
+
+		code := rec.code
+		if code == 0 {
+			code = http.StatusOK
+		}
+		attrs := []any{
+			"request_id", l.id,
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", code,
+			"duration", time.Since(start),
+			"registry_requests", l.registryRequests.Load(),
+		}
+		if image := r.URL.Query().Get("image"); image != "" {
+			attrs = append(attrs, "image", image)
+		}
+		l.mu.Lock()
+		if l.outcome != "" {
+			attrs = append(attrs, "outcome", l.outcome)
+		}
+		l.mu.Unlock()
+		slog.Info("request", attrs...)
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,394 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/secure-systems-lab/go-securesystemslib/dsse"
+	"github.com/sigstore/fulcio/pkg/certificate"
+	"golang.org/x/exp/slog"
+)
+
+// The api* types are the JSON representation of output served by /api/v1.
+// They are kept separate from output so that the wire format stays stable
+// regardless of how the underlying libraries represent things.
+
+type apiOutput struct {
+	Ref         string `json:"ref"`
+	ResolvedRef string `json:"resolvedRef"`
+	Partial     bool   `json:"partial,omitempty"`
+	// Platform and IndexRef are set if a platform of an index was requested.
+	Platform string `json:"platform,omitempty"`
+	IndexRef string `json:"indexRef,omitempty"`
+	// Expected and Match are only set if an expected digest was given.
+	Expected   string           `json:"expected,omitempty"`
+	Match      *bool            `json:"match,omitempty"`
+	LastSigned *time.Time       `json:"lastSigned,omitempty"`
+	Stale      bool             `json:"stale,omitempty"`
+	Policy     *policyResult    `json:"policy,omitempty"`
+	SLSA       *slsaResult      `json:"slsa,omitempty"`
+	History    []tagObservation `json:"history,omitempty"`
+	Metadata   *imageMetadata   `json:"metadata,omitempty"`
+	// IndexAnnotations and IndexSubject are those of the index itself, if
+	// ResolvedRef is one.
+	IndexAnnotations map[string]string `json:"indexAnnotations,omitempty"`
+	IndexSubject     *v1.Descriptor    `json:"indexSubject,omitempty"`
+	Manifests        []*apiManifest    `json:"manifests"`
+}
+
+type apiManifest struct {
+	Name         string `json:"name"`
+	Platform     string `json:"platform,omitempty"`
+	Digest       string `json:"digest,omitempty"`
+	MediaType    string `json:"mediaType,omitempty"`
+	ArtifactType string `json:"artifactType,omitempty"`
+	Error        string `json:"error,omitempty"`
+	// Total is how many entries the manifest has. Data is the page of them
+	// starting at Offset.
+	Total  int             `json:"total"`
+	Offset int             `json:"offset"`
+	Data   []*apiSignature `json:"data"`
+}
+
+type apiSignature struct {
+	Layer         string         `json:"layer"`
+	LayerType     string         `json:"layerType"`
+	PredicateType string         `json:"predicateType,omitempty"`
+	Provenance    *apiProvenance `json:"provenance,omitempty"`
+	Scan          *apiScan       `json:"scan,omitempty"`
+	SBOM          *apiSBOM       `json:"sbom,omitempty"`
+	Discovery     string         `json:"discovery,omitempty"`
+	// DetachedSignature is the blob holding the signature, if it isn't
+	// inline.
+	DetachedSignature string `json:"detachedSignature,omitempty"`
+	// MessageDigest is the artifact digest a sigstore bundle's message
+	// signature covers.
+	MessageDigest string `json:"messageDigest,omitempty"`
+	// SignedDigest is the image digest a simple signing payload covers.
+	SignedDigest   string          `json:"signedDigest,omitempty"`
+	DigestMismatch bool            `json:"digestMismatch,omitempty"`
+	Verified       *bool           `json:"verified,omitempty"`
+	SCTVerified    *bool           `json:"sctVerified,omitempty"`
+	TlogVerified   *bool           `json:"tlogVerified,omitempty"`
+	Certificate    *apiCertificate `json:"certificate,omitempty"`
+	Rekor          *apiRekor       `json:"rekor,omitempty"`
+	Notation       *apiNotation    `json:"notation,omitempty"`
+	Envelope       *dsse.Envelope  `json:"envelope,omitempty"`
+}
+
+type apiProvenance struct {
+	BuilderID    string   `json:"builderID,omitempty"`
+	BuildType    string   `json:"buildType,omitempty"`
+	Source       string   `json:"source,omitempty"`
+	SourceDigest string   `json:"sourceDigest,omitempty"`
+	EntryPoint   string   `json:"entryPoint,omitempty"`
+	Materials    []string `json:"materials,omitempty"`
+	Reproducible bool     `json:"reproducible,omitempty"`
+}
+
+type apiSBOM struct {
+	Format      string   `json:"format"`
+	SpecVersion string   `json:"specVersion,omitempty"`
+	Name        string   `json:"name,omitempty"`
+	Components  int      `json:"components"`
+	Tools       []string `json:"tools,omitempty"`
+}
+
+type apiNotation struct {
+	Format       string     `json:"format"`
+	Scheme       string     `json:"scheme,omitempty"`
+	SigningTime  *time.Time `json:"signingTime,omitempty"`
+	SigningAgent string     `json:"signingAgent,omitempty"`
+}
+
+type apiScan struct {
+	Scanner string         `json:"scanner,omitempty"`
+	Counts  map[string]int `json:"counts"`
+}
+
+type apiCertificate struct {
+	Subject    string                 `json:"subject"`
+	Issuer     string                 `json:"issuer"`
+	SANs       []string               `json:"sans,omitempty"`
+	Key        string                 `json:"key"`
+	NotBefore  time.Time              `json:"notBefore"`
+	NotAfter   time.Time              `json:"notAfter"`
+	Extensions certificate.Extensions `json:"extensions"`
+	// Chain is the subject of each certificate the leaf chains to.
+	Chain []string `json:"chain,omitempty"`
+}
+
+type apiRekor struct {
+	LogID          string    `json:"logID"`
+	LogIndex       int64     `json:"logIndex"`
+	IntegratedTime time.Time `json:"integratedTime"`
+	// TreeSize is the size of the log the inclusion proof is against, if
+	// there is one.
+	TreeSize int64 `json:"treeSize,omitempty"`
+}
+
+func toAPI(out *output) *apiOutput {
+	a := &apiOutput{
+		Ref:         out.Ref.String(),
+		ResolvedRef: out.ResolvedRef.String(),
+		Partial:     out.Partial,
+		Policy:      out.Policy,
+		SLSA:        out.SLSA,
+		Stale:       out.Stale,
+		History:     out.History,
+		Metadata:    out.Metadata,
+	}
+	if out.IndexRef != nil {
+		a.Platform = out.Platform
+		a.IndexRef = out.IndexRef.String()
+	}
+	if !out.LastSigned.IsZero() {
+		a.LastSigned = &out.LastSigned
+	}
+	if out.Expected != "" {
+		a.Expected = out.Expected
+		a.Match = &out.Match
+	}
+	if out.Index && len(out.Groups) > 0 {
+		a.IndexAnnotations = out.Groups[0].Annotations
+		a.IndexSubject = out.Groups[0].Subject
+	}
+	for _, g := range out.Groups {
+		a.Manifests = append(a.Manifests, apiManifests(g, out.Page, out.Raw)...)
+	}
+	return a
+}
+
+func apiManifests(g *group, p *page, raw bool) []*apiManifest {
+	var out []*apiManifest
+	for _, m := range g.Data {
+		data := pageOf(p, m.Data)
+		am := &apiManifest{
+			Name:         m.Name,
+			Platform:     g.Platform,
+			Digest:       m.Digest,
+			MediaType:    m.MediaType,
+			ArtifactType: m.ArtifactType,
+			Error:        m.Error,
+			Total:        len(m.Data),
+			Data:         make([]*apiSignature, 0, len(data)),
+		}
+		if p != nil {
+			am.Offset = p.Offset
+		}
+		for _, d := range data {
+			s := &apiSignature{
+				Layer:          d.Layer.String(),
+				LayerType:      d.LayerType,
+				PredicateType:  d.PredicateType,
+				Discovery:      d.Discovery,
+				SignedDigest:   d.SignedDigest,
+				DigestMismatch: d.DigestMismatch,
+			}
+			if p := d.Provenance; p != nil {
+				s.Provenance = &apiProvenance{
+					BuilderID:    p.BuilderID,
+					BuildType:    p.BuildType,
+					Source:       p.Source,
+					SourceDigest: p.SourceDigest,
+					EntryPoint:   p.EntryPoint,
+					Materials:    p.Materials,
+					Reproducible: p.Reproducible,
+				}
+			}
+			if d.Verification != nil {
+				s.Verified = &d.Verification.OK
+			}
+			if d.DetachedSignature != nil {
+				s.DetachedSignature = d.DetachedSignature.String()
+			}
+			if d.MessageSignature != nil {
+				s.MessageDigest = d.MessageSignature.Digest
+			}
+			if d.SCT != nil {
+				s.SCTVerified = &d.SCT.OK
+			}
+			if d.Tlog != nil {
+				s.TlogVerified = &d.Tlog.OK
+			}
+			if n := d.Notation; n != nil {
+				s.Notation = &apiNotation{Format: n.Format, Scheme: n.Scheme, SigningAgent: n.SigningAgent}
+				if !n.SigningTime.IsZero() {
+					s.Notation.SigningTime = &n.SigningTime
+				}
+			}
+			if d.Scan != nil {
+				s.Scan = &apiScan{Scanner: d.Scan.Scanner, Counts: d.Scan.Counts}
+			}
+			if b := d.SBOM; b != nil {
+				s.SBOM = &apiSBOM{Format: b.Format, SpecVersion: b.SpecVersion, Name: b.Name, Components: b.Components, Tools: b.Tools}
+			}
+			if d.Cert != nil {
+				s.Certificate = apiCert(d.Cert, d.Chain, d.Extensions)
+			}
+			if d.Bundle != nil {
+				s.Rekor = &apiRekor{
+					LogID:          d.Bundle.Payload.LogID,
+					LogIndex:       d.Bundle.Payload.LogIndex,
+					IntegratedTime: time.Unix(d.Bundle.Payload.IntegratedTime, 0).UTC(),
+				}
+				if p := d.InclusionProof; p != nil && p.TreeSize != nil {
+					s.Rekor.TreeSize = *p.TreeSize
+				}
+			}
+			if raw {
+				s.Envelope = d.Envelope
+			}
+			am.Data = append(am.Data, s)
+		}
+		out = append(out, am)
+	}
+	return out
+}
+
+func apiCert(cert *x509.Certificate, chain []*x509.Certificate, ext certificate.Extensions) *apiCertificate {
+	out := &apiCertificate{
+		Subject:    cert.Subject.String(),
+		Issuer:     cert.Issuer.String(),
+		NotBefore:  cert.NotBefore.UTC(),
+		NotAfter:   cert.NotAfter.UTC(),
+		SANs:       sans(cert),
+		Key:        certKeyInfo(cert),
+		Extensions: ext,
+	}
+	for _, c := range chain {
+		out.Chain = append(out.Chain, c.Subject.String())
+	}
+	return out
+}
+
+// wantsJSON reports whether the client asked for JSON via the Accept header.
+func wantsJSON(r *http.Request) bool {
+	for _, v := range strings.Split(r.Header.Get("Accept"), ",") {
+		mt, _, err := mime.ParseMediaType(strings.TrimSpace(v))
+		if err == nil && mt == "application/json" {
+			return true
+		}
+	}
+	return false
+}
+
+// writeRaw serves the raw=manifest and raw=referrers views of out, reporting
+// whether the request asked for one.
+func writeRaw(w http.ResponseWriter, r *http.Request, code int, out *output) bool {
+	switch r.URL.Query().Get("raw") {
+	case "manifest":
+		writeRawManifests(w, code, out)
+	case "referrers":
+		writeJSON(w, code, rawReferrersOf(out))
+	default:
+		return false
+	}
+	return true
+}
+
+// rawReferrers is an entry of the raw=referrers response.
+type rawReferrers struct {
+	Platform string          `json:"platform,omitempty"`
+	Subject  string          `json:"subject"`
+	Index    json.RawMessage `json:"index"`
+}
+
+// rawReferrersOf returns the referrers index the registry returned for each
+// image in out, for comparing against what was parsed out of it.
+func rawReferrersOf(out *output) []rawReferrers {
+	rs := []rawReferrers{}
+	for _, g := range out.Groups {
+		if g.ReferrersIndex == nil {
+			continue
+		}
+		rs = append(rs, rawReferrers{
+			Platform: g.Platform,
+			Subject:  g.Ref.DigestStr(),
+			Index:    g.ReferrersIndex,
+		})
+	}
+	return rs
+}
+
+// rawManifest is an entry of the raw=manifest response.
+type rawManifest struct {
+	Name     string          `json:"name"`
+	Platform string          `json:"platform,omitempty"`
+	Digest   string          `json:"digest"`
+	Manifest json.RawMessage `json:"manifest"`
+}
+
+// writeRawManifests writes the manifests of the signatures, attestations etc.
+// found for out as a JSON array, exactly as the registry served them (but
+// indented). Each is written out as soon as it's encoded rather than
+// building up the whole response, since some tools produce very large
+// manifests.
+func writeRawManifests(w http.ResponseWriter, code int, out *output) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	flusher, _ := w.(http.Flusher)
+
+	io.WriteString(w, "[")
+	n := 0
+	for _, g := range out.Groups {
+		for _, m := range g.Data {
+			if m.Manifest == nil {
+				continue
+			}
+			b, err := json.MarshalIndent(rawManifest{
+				Name:     m.Name,
+				Platform: g.Platform,
+				Digest:   m.Digest,
+				Manifest: m.Manifest,
+			}, "  ", "  ")
+			if err != nil {
+				slog.Warn("failed to encode manifest", "digest", m.Digest, "error", err)
+				continue
+			}
+			if n > 0 {
+				io.WriteString(w, ",")
+			}
+			io.WriteString(w, "\n  ")
+			if _, err := w.Write(b); err != nil {
+				slog.Warn("failed to write JSON response", "error", err)
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+			n++
+		}
+	}
+	io.WriteString(w, "\n]\n")
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		slog.Warn("failed to write JSON response", "error", err)
+	}
+}
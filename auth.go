@@ -0,0 +1,66 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+)
+
+// registryAuthHeader lets callers supply credentials for the registry being
+// inspected, for that request only. It takes the same form as an
+// Authorization header:
+//
+//	X-Registry-Authorization: Bearer <registry token>
+//	X-Registry-Authorization: Basic <base64(username:password)>
+//
+// The credentials are only ever handed to go-containerregistry; they must not
+// be logged or stored.
+const registryAuthHeader = "X-Registry-Authorization"
+
+var errInvalidRegistryAuth = errors.New("invalid " + registryAuthHeader + " header: must be \"Bearer <token>\" or \"Basic <base64(username:password)>\"")
+
+// requestAuth returns the registry credentials supplied with r, or nil if
+// there are none.
+func requestAuth(r *http.Request) (authn.Authenticator, error) {
+	h := r.Header.Get(registryAuthHeader)
+	if h == "" {
+		return nil, nil
+	}
+	scheme, value, ok := strings.Cut(h, " ")
+	value = strings.TrimSpace(value)
+	if !ok || value == "" {
+		return nil, errInvalidRegistryAuth
+	}
+	switch strings.ToLower(scheme) {
+	case "bearer":
+		return authn.FromConfig(authn.AuthConfig{RegistryToken: value}), nil
+	case "basic":
+		b, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, errInvalidRegistryAuth
+		}
+		user, pass, ok := strings.Cut(string(b), ":")
+		if !ok {
+			return nil, errInvalidRegistryAuth
+		}
+		return authn.FromConfig(authn.AuthConfig{Username: user, Password: pass}), nil
+	}
+	return nil, errInvalidRegistryAuth
+}
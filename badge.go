@@ -0,0 +1,136 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"text/template"
+	"time"
+	"unicode/utf8"
+)
+
+// Badge colors, matching the shields.io palette.
+const (
+	badgeGreen = "#4c1"
+	badgeRed   = "#e05d44"
+	badgeGrey  = "#9f9f9f"
+	badgeLabel = "#555"
+)
+
+// badgeSegment is one label/value pair of a badge, e.g. "signed: yes".
+type badgeSegment struct {
+	Label, Value, Color string
+}
+
+// badgeCell is a single colored box of a rendered badge.
+type badgeCell struct {
+	X, Width, TextX int
+	Text, Color     string
+}
+
+var badgeTmpl = template.Must(template.New("badge").Funcs(template.FuncMap{
+	"xml": template.HTMLEscapeString,
+}).Parse(`<svg xmlns="http://www.w3.org/2000/svg" width="{{ .Width }}" height="20" role="img" aria-label="{{ xml .Title }}">
+<title>{{ xml .Title }}</title>
+<linearGradient id="s" x2="0" y2="100%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>
+<clipPath id="r"><rect width="{{ .Width }}" height="20" rx="3" fill="#fff"/></clipPath>
+<g clip-path="url(#r)">
+{{- range .Cells }}
+<rect x="{{ .X }}" width="{{ .Width }}" height="20" fill="{{ .Color }}"/>
+{{- end }}
+<rect width="{{ .Width }}" height="20" fill="url(#s)"/>
+</g>
+<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">
+{{- range .Cells }}
+<text x="{{ .TextX }}" y="15" fill="#010101" fill-opacity=".3">{{ xml .Text }}</text>
+<text x="{{ .TextX }}" y="14">{{ xml .Text }}</text>
+{{- end }}
+</g>
+</svg>
+`))
+
+// renderBadge draws segments side by side as a flat shields.io-style badge.
+// Text width is estimated rather than measured, which is close enough for
+// the short ASCII strings we use.
+func renderBadge(segments []badgeSegment) ([]byte, error) {
+	var (
+		cells []badgeCell
+		title string
+		x     int
+	)
+	add := func(text, color string) {
+		w := utf8.RuneCountInString(text)*7 + 10
+		cells = append(cells, badgeCell{X: x, Width: w, TextX: x + w/2, Text: text, Color: color})
+		x += w
+	}
+	for i, s := range segments {
+		add(s.Label, badgeLabel)
+		add(s.Value, s.Color)
+		if i > 0 {
+			title += ", "
+		}
+		title += s.Label + ": " + s.Value
+	}
+
+	var b bytes.Buffer
+	if err := badgeTmpl.Execute(&b, struct {
+		Width int
+		Title string
+		Cells []badgeCell
+	}{x, title, cells}); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// badgeSegments summarizes out as "signed: yes/no", plus "attested: yes" if
+// there are any attestations.
+func badgeSegments(out *output) []badgeSegment {
+	sum := toSummary(out, time.Now())
+	segments := []badgeSegment{{Label: "signed", Value: "no", Color: badgeRed}}
+	if len(sum.Signatures) > 0 {
+		segments[0].Value, segments[0].Color = "yes", badgeGreen
+	}
+	if len(sum.Attestations) > 0 {
+		segments = append(segments, badgeSegment{Label: "attested", Value: "yes", Color: badgeGreen})
+	}
+	return segments
+}
+
+// handleBadge serves an SVG badge for embedding in READMEs. Lookup failures
+// still produce a (grey) badge with a 200, since image proxies like GitHub's
+// camo replace error responses with a broken image.
+func (s *server) handleBadge(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("image") == "" {
+		http.Error(w, "missing image parameter", http.StatusBadRequest)
+		return
+	}
+	segments := []badgeSegment{{Label: "signed", Value: "unknown", Color: badgeGrey}}
+	out, _, err := s.lookup(r)
+	if err == nil && !out.Partial {
+		segments = badgeSegments(out)
+	}
+	b, err := renderBadge(segments)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error rendering badge: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.Write(b)
+}
@@ -0,0 +1,73 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+
+	"golang.org/x/exp/slog"
+)
+
+var errBudgetExceeded = errors.New("request budget exceeded")
+
+type budgetKey struct{}
+
+// budget bounds the number of outbound registry requests made on behalf of a
+// single inspection, so that pathological images (huge indexes, lots of
+// referrers) can't fan out indefinitely.
+type budget struct {
+	max  int64
+	used atomic.Int64
+}
+
+// withBudget returns a context that allows at most max registry requests.
+// A max <= 0 means unlimited.
+func withBudget(ctx context.Context, max int64) context.Context {
+	return context.WithValue(ctx, budgetKey{}, &budget{max: max})
+}
+
+func budgetFrom(ctx context.Context) *budget {
+	b, _ := ctx.Value(budgetKey{}).(*budget)
+	return b
+}
+
+// budgetExceeded reports whether any request was refused because the budget
+// in ctx ran out.
+func budgetExceeded(ctx context.Context) bool {
+	b := budgetFrom(ctx)
+	return b != nil && b.max > 0 && b.used.Load() > b.max
+}
+
+// budgetTransport refuses requests once the budget in the request context is
+// spent. It also counts every request for the registry requests metric and
+// the access log.
+type budgetTransport struct {
+	base http.RoundTripper
+}
+
+func (t *budgetTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if b := budgetFrom(r.Context()); b != nil && b.max > 0 && b.used.Add(1) > b.max {
+		return nil, errBudgetExceeded
+	}
+	registryRequestsTotal.Inc()
+	if l := requestLogFrom(r.Context()); l != nil {
+		l.registryRequests.Add(1)
+		slog.Debug("registry request", "request_id", l.id, "method", r.Method, "url", r.URL.Redacted())
+	}
+	return t.base.RoundTrip(r)
+}
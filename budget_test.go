@@ -0,0 +1,114 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+func TestBudgetTransport(t *testing.T) {
+	host := newTestRegistry(t)
+	c := &http.Client{Transport: &budgetTransport{base: http.DefaultTransport}}
+	get := func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+host+"/v2/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := c.Do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	ctx := withBudget(context.Background(), 2)
+	for i := 0; i < 2; i++ {
+		if err := get(ctx); err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+	}
+	if budgetExceeded(ctx) {
+		t.Error("budget exceeded before it was spent")
+	}
+	if err := get(ctx); !errors.Is(err, errBudgetExceeded) {
+		t.Errorf("got %v, want %v", err, errBudgetExceeded)
+	}
+	if !budgetExceeded(ctx) {
+		t.Error("budget not exceeded")
+	}
+
+	// No budget, or one of zero, is unlimited.
+	for _, ctx := range []context.Context{context.Background(), withBudget(context.Background(), 0)} {
+		for i := 0; i < 5; i++ {
+			if err := get(ctx); err != nil {
+				t.Fatalf("request %d: %v", i, err)
+			}
+		}
+		if budgetExceeded(ctx) {
+			t.Error("unlimited budget exceeded")
+		}
+	}
+}
+
+func TestHandleRefBudgetExhausted(t *testing.T) {
+	var requests atomic.Int64
+	host := newTestRegistryWith(t, func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests.Add(1)
+			h.ServeHTTP(w, r)
+		})
+	})
+	repo, err := name.NewRepository(host + "/foo/bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := pushImage(t, repo.Tag("latest"))
+	pushManifest(t, cosignTag(d, "sig"), artifact(t, signatureLayer(d, nil)))
+	lo := lookupOptions{
+		discovery: discoveryBoth,
+		remote:    []remote.Option{remote.WithTransport(&budgetTransport{base: remote.DefaultTransport})},
+	}
+
+	// See how many requests the whole lookup takes, then allow one fewer.
+	requests.Store(0)
+	if _, err := handleRef(context.Background(), d, lo); err != nil {
+		t.Fatal(err)
+	}
+	n := requests.Load()
+
+	lo.cache = newResultCache(time.Hour, 10)
+	out, err := handleRef(withBudget(context.Background(), n-1), d, lo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !out.Partial {
+		t.Error("result isn't marked partial")
+	}
+	if md := renderTemplate(t, out); !strings.Contains(md, "Partial results") {
+		t.Errorf("page doesn't say the results are partial:\n%s", md)
+	}
+	if lo.cache.lru.Len() != 0 {
+		t.Error("partial result was cached")
+	}
+}
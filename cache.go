@@ -0,0 +1,105 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// cachedResult is the expensive part of a lookup: everything we found attached
+// to a resolved digest.
+type cachedResult struct {
+	index  bool
+	groups []*group
+}
+
+// minRefreshInterval is how often refresh=true will refetch an entry.
+// Anything more often just gets the cached result, so that refreshing can't
+// be used to defeat the cache.
+const minRefreshInterval = time.Minute
+
+type cacheEntry struct {
+	key     string
+	fetched time.Time
+	expires time.Time
+	result  *cachedResult
+}
+
+// resultCache is a size-bounded LRU cache of lookup results with a TTL. It is
+// keyed by resolved digest, so tags are always re-resolved.
+type resultCache struct {
+	ttl time.Duration
+	max int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+func newResultCache(ttl time.Duration, max int) *resultCache {
+	return &resultCache{
+		ttl:     ttl,
+		max:     max,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// get returns the result cached under key. If refresh is set, results
+// fetched at least minRefreshInterval ago are treated as expired.
+func (c *resultCache) get(key string, now time.Time, refresh bool) (*cachedResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		cacheLookupsTotal.WithLabelValues("miss").Inc()
+		return nil, false
+	}
+	e := el.Value.(*cacheEntry)
+	if refresh && now.Sub(e.fetched) >= minRefreshInterval {
+		cacheLookupsTotal.WithLabelValues("miss").Inc()
+		return nil, false
+	}
+	if now.After(e.expires) {
+		c.lru.Remove(el)
+		delete(c.entries, key)
+		cacheLookupsTotal.WithLabelValues("miss").Inc()
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+	cacheLookupsTotal.WithLabelValues("hit").Inc()
+	return e.result, true
+}
+
+func (c *resultCache) put(key string, r *cachedResult, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		e := el.Value.(*cacheEntry)
+		e.result, e.fetched, e.expires = r, now, now.Add(c.ttl)
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, fetched: now, expires: now.Add(c.ttl), result: r})
+	for c.lru.Len() > c.max {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
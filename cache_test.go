@@ -0,0 +1,91 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestResultCacheTTL(t *testing.T) {
+	c := newResultCache(time.Hour, 10)
+	now := time.Now()
+	r := &cachedResult{}
+	c.put("a", r, now)
+
+	if got, ok := c.get("a", now.Add(time.Hour), false); !ok || got != r {
+		t.Error("entry gone before its TTL")
+	}
+	if _, ok := c.get("a", now.Add(time.Hour+time.Second), false); ok {
+		t.Error("entry still there after its TTL")
+	}
+	// Expired entries are dropped, not just hidden.
+	if _, ok := c.get("a", now, false); ok {
+		t.Error("expired entry came back")
+	}
+}
+
+func TestResultCacheLRU(t *testing.T) {
+	c := newResultCache(time.Hour, 2)
+	now := time.Now()
+	c.put("a", &cachedResult{}, now)
+	c.put("b", &cachedResult{}, now)
+	// Using a makes b the least recently used.
+	c.get("a", now, false)
+	c.put("c", &cachedResult{}, now)
+
+	for key, want := range map[string]bool{"a": true, "b": false, "c": true} {
+		if _, ok := c.get(key, now, false); ok != want {
+			t.Errorf("%s cached: got %t, want %t", key, ok, want)
+		}
+	}
+}
+
+func TestResultCacheRefresh(t *testing.T) {
+	c := newResultCache(time.Hour, 10)
+	now := time.Now()
+	c.put("a", &cachedResult{}, now)
+
+	// Refreshing straight away still gets the cached result.
+	if _, ok := c.get("a", now.Add(minRefreshInterval-time.Second), true); !ok {
+		t.Error("refresh refetched a fresh entry")
+	}
+	if _, ok := c.get("a", now.Add(minRefreshInterval), true); ok {
+		t.Error("refresh didn't refetch")
+	}
+	// Refreshing doesn't evict the entry for everyone else.
+	if _, ok := c.get("a", now.Add(minRefreshInterval), false); !ok {
+		t.Error("refresh evicted the entry")
+	}
+}
+
+func TestHandleRefCached(t *testing.T) {
+	repo := newTestRepo(t)
+	d := pushImage(t, repo.Tag("latest"))
+	lo := lookupOptions{discovery: discoveryTag, cache: newResultCache(time.Hour, 10)}
+	if _, err := handleRef(context.Background(), d, lo); err != nil {
+		t.Fatal(err)
+	}
+	// Signing the image doesn't show up until the entry's refreshed.
+	pushManifest(t, cosignTag(d, "sig"), artifact(t, signatureLayer(d, nil)))
+	out, err := handleRef(context.Background(), d, lo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Verdict.Signed {
+		t.Error("lookup wasn't cached")
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// runCLI looks up image once, writing the report to w in the given format
+// (markdown, json or term), and returns the process exit code.
+//
+// The lookup goes through the same path as the HTTP handlers (by way of a
+// synthesized request) so that the CLI and web output never drift apart.
+func (s *server) runCLI(ctx context.Context, w, errw io.Writer, image, format string) int {
+	switch format {
+	case "markdown", "json", "term":
+	default:
+		fmt.Fprintf(errw, "unknown output format %q: want markdown, json or term\n", format)
+		return 2
+	}
+
+	q := url.Values{"image": {image}}
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, "/?"+q.Encode(), nil)
+	if err != nil {
+		fmt.Fprintln(errw, err)
+		return 1
+	}
+	out, _, err := s.lookup(r)
+	if err != nil {
+		fmt.Fprintln(errw, err)
+		return 1
+	}
+
+	out.CLI = true
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(toAPI(out))
+	case "term":
+		// The terminal rendering starts from the same markdown, so it shows
+		// the same report.
+		var b bytes.Buffer
+		if err = tmpl.ExecuteTemplate(&b, "template.md", out); err == nil {
+			// https://no-color.org
+			_, err = w.Write(renderTerm(b.Bytes(), os.Getenv("NO_COLOR") == ""))
+		}
+	default:
+		err = tmpl.ExecuteTemplate(w, "template.md", out)
+	}
+	if err != nil {
+		fmt.Fprintln(errw, err)
+		return 1
+	}
+	return 0
+}
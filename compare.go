@@ -0,0 +1,103 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+)
+
+// comparison is two images' signing metadata side by side.
+type comparison struct {
+	A, B *output
+	Rows []compareRow
+}
+
+// compareRow is one field of the SignatureData of both images, as the sorted
+// set of distinct values across all their signatures and attestations.
+type compareRow struct {
+	Field string
+	A, B  []string
+	// Differs is set if the two images have different sets of values.
+	Differs bool
+}
+
+// compareOutputs compares who signed a and b, and what they attested to.
+func compareOutputs(a, b *output) *comparison {
+	fields := []struct {
+		name  string
+		value func(*SignatureData) string
+	}{
+		{"Signer identity", func(s *SignatureData) string { return subjectAltName(s.Cert) }},
+		{"Issuer", func(s *SignatureData) string { return s.Extensions.Issuer }},
+		{"Predicate type", func(s *SignatureData) string { return s.PredicateType }},
+		{"Build config", func(s *SignatureData) string { return s.Extensions.BuildConfigURI }},
+	}
+	c := &comparison{A: a, B: b}
+	for _, f := range fields {
+		row := compareRow{Field: f.name, A: distinct(a, f.value), B: distinct(b, f.value)}
+		row.Differs = !slices.Equal(row.A, row.B)
+		c.Rows = append(c.Rows, row)
+	}
+	return c
+}
+
+// distinct returns the sorted, non-empty values of value across out.
+func distinct(out *output, value func(*SignatureData) string) []string {
+	seen := map[string]bool{}
+	for _, g := range out.Groups {
+		for _, m := range g.Data {
+			for _, s := range m.Data {
+				if v := value(s); v != "" {
+					seen[v] = true
+				}
+			}
+		}
+	}
+	vs := make([]string, 0, len(seen))
+	for v := range seen {
+		vs = append(vs, v)
+	}
+	sort.Strings(vs)
+	return vs
+}
+
+// handleCompare renders the images given by the a and b params side by side.
+// Any other params (e.g. platform) apply to both lookups.
+func (s *server) handleCompare(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("a") == "" || q.Get("b") == "" {
+		s.writeError(w, r, http.StatusBadRequest, errors.New("missing a or b image parameter"))
+		return
+	}
+	var outs [2]*output
+	for i, image := range []string{q.Get("a"), q.Get("b")} {
+		lq := r.URL.Query()
+		lq.Set("image", image)
+		lr := r.Clone(r.Context())
+		lr.URL.RawQuery = lq.Encode()
+
+		out, code, err := s.lookup(lr)
+		if err != nil {
+			s.writeError(w, r, code, fmt.Errorf("error looking up %s: %w", image, err))
+			return
+		}
+		outs[i] = out
+	}
+	s.renderMarkdown(w, r, http.StatusOK, "compare.md", compareOutputs(outs[0], outs[1]))
+}
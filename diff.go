@@ -0,0 +1,136 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// reportDiff describes how an image changed relative to a baseline report.
+type reportDiff struct {
+	// Changed is set if anything differs between the two reports.
+	Changed        bool            `json:"changed"`
+	Ref            string          `json:"ref"`
+	DigestChanged  bool            `json:"digestChanged"`
+	BaselineDigest string          `json:"baselineDigest"`
+	CurrentDigest  string          `json:"currentDigest"`
+	Manifests      []*manifestDiff `json:"manifests"`
+}
+
+type manifestDiff struct {
+	Name     string `json:"name"`
+	Platform string `json:"platform,omitempty"`
+	// Added/Removed are the layers (i.e. individual signatures or
+	// attestations) that only exist in the current or baseline report.
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+	// AddedIdentities/RemovedIdentities are the signer identities that only
+	// exist in the current or baseline report.
+	AddedIdentities   []string `json:"addedIdentities,omitempty"`
+	RemovedIdentities []string `json:"removedIdentities,omitempty"`
+}
+
+func diffReports(baseline, current *apiOutput) *reportDiff {
+	d := &reportDiff{
+		Ref:            current.Ref,
+		BaselineDigest: baseline.ResolvedRef,
+		CurrentDigest:  current.ResolvedRef,
+		DigestChanged:  digestOf(baseline.ResolvedRef) != digestOf(current.ResolvedRef),
+	}
+
+	key := func(m *apiManifest) string { return m.Name + " " + m.Platform }
+	old := make(map[string]*apiManifest, len(baseline.Manifests))
+	for _, m := range baseline.Manifests {
+		old[key(m)] = m
+	}
+	for _, m := range current.Manifests {
+		d.Manifests = append(d.Manifests, diffManifest(old[key(m)], m))
+		delete(old, key(m))
+	}
+	// Anything left over only exists in the baseline.
+	for _, m := range baseline.Manifests {
+		if _, ok := old[key(m)]; ok {
+			d.Manifests = append(d.Manifests, diffManifest(m, &apiManifest{Name: m.Name, Platform: m.Platform}))
+		}
+	}
+
+	d.Changed = d.DigestChanged
+	for _, m := range d.Manifests {
+		if len(m.Added)+len(m.Removed)+len(m.AddedIdentities)+len(m.RemovedIdentities) > 0 {
+			d.Changed = true
+		}
+	}
+	return d
+}
+
+func diffManifest(baseline, current *apiManifest) *manifestDiff {
+	if baseline == nil {
+		baseline = &apiManifest{Name: current.Name, Platform: current.Platform}
+	}
+	d := &manifestDiff{Name: current.Name, Platform: current.Platform}
+	d.Added, d.Removed = diffSets(layerSet(baseline), layerSet(current))
+	d.AddedIdentities, d.RemovedIdentities = diffSets(identitySet(baseline), identitySet(current))
+	return d
+}
+
+// layerSet returns the set of layer digests in m. Layers are keyed by digest
+// alone so that a change in repository (e.g. a mirrored baseline) doesn't
+// count as a change.
+func layerSet(m *apiManifest) map[string]bool {
+	out := make(map[string]bool, len(m.Data))
+	for _, s := range m.Data {
+		out[digestOf(s.Layer)] = true
+	}
+	return out
+}
+
+// identitySet returns the set of "<SANs> (<issuer>)" identities that signed
+// the layers in m.
+func identitySet(m *apiManifest) map[string]bool {
+	out := make(map[string]bool, len(m.Data))
+	for _, s := range m.Data {
+		if s.Certificate == nil {
+			continue
+		}
+		out[strings.Join(s.Certificate.SANs, " ")+" ("+s.Certificate.Extensions.Issuer+")"] = true
+	}
+	return out
+}
+
+// diffSets returns the sorted keys only in b (added) and only in a (removed).
+func diffSets(a, b map[string]bool) (added, removed []string) {
+	for k := range b {
+		if !a[k] {
+			added = append(added, k)
+		}
+	}
+	for k := range a {
+		if !b[k] {
+			removed = append(removed, k)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
+
+// digestOf returns the "sha256:..." portion of a digest reference string.
+func digestOf(ref string) string {
+	if _, d, ok := strings.Cut(ref, "@"); ok {
+		return d
+	}
+	return ref
+}
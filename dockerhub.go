@@ -0,0 +1,67 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+// dockerHubKeychain authenticates to Docker Hub, and only Docker Hub, with a
+// fixed username and access token. Anonymous pulls from Docker Hub are
+// rate limited per IP, which a shared server runs into quickly.
+type dockerHubKeychain struct {
+	auth authn.Authenticator
+}
+
+func (k dockerHubKeychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
+	if target.RegistryStr() != name.DefaultRegistry {
+		return authn.Anonymous, nil
+	}
+	return k.auth, nil
+}
+
+// isRateLimited reports whether err is the registry turning a request away
+// for exceeding its rate limit.
+func isRateLimited(err error) bool {
+	var terr *transport.Error
+	if !errors.As(err, &terr) {
+		return false
+	}
+	if terr.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	for _, d := range terr.Errors {
+		if d.Code == transport.TooManyRequestsErrorCode {
+			return true
+		}
+	}
+	return false
+}
+
+// rateLimitMessage explains a rate-limited lookup of ref. Docker Hub's limits
+// are the ones people hit in practice, and are lifted by authenticating.
+func rateLimitMessage(ref name.Reference) string {
+	if ref.Context().RegistryStr() != name.DefaultRegistry {
+		return ref.Context().RegistryStr() + " is rate limiting lookups, try again later"
+	}
+	return "Docker Hub's pull rate limit was reached. Anonymous pulls are limited per IP address, " +
+		"and this server is shared; try again later, or pass your own Docker Hub credentials with the " +
+		registryAuthHeader + " header, which count against your account's limit instead"
+}
@@ -0,0 +1,105 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+// dockerHubRateLimited is the body Docker Hub sends with its 429s.
+const dockerHubRateLimited = `{"errors":[{"code":"TOOMANYREQUESTS","message":"You have reached your pull rate limit. You may increase the limit by authenticating and upgrading: https://www.docker.com/increase-rate-limit"}]}`
+
+func TestResolveRateLimited(t *testing.T) {
+	host := newTestRegistryWith(t, func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.Contains(r.URL.Path, "/manifests/") {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusTooManyRequests)
+				fmt.Fprint(w, dockerHubRateLimited)
+				return
+			}
+			h.ServeHTTP(w, r)
+		})
+	})
+
+	_, code, err := resolve(t, newTestServer(), host+"/foo/bar:latest", nil)
+	if code != http.StatusTooManyRequests {
+		t.Errorf("status: got %d (%v), want %d", code, err, http.StatusTooManyRequests)
+	}
+	if err == nil || !strings.Contains(err.Error(), "rate limiting") {
+		t.Errorf("want the rate limit explained, got %v", err)
+	}
+}
+
+func TestIsRateLimited(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"429", &transport.Error{StatusCode: http.StatusTooManyRequests}, true},
+		{"error code", fmt.Errorf("wrapped: %w", &transport.Error{StatusCode: http.StatusForbidden, Errors: []transport.Diagnostic{{Code: transport.TooManyRequestsErrorCode}}}), true},
+		{"not found", &transport.Error{StatusCode: http.StatusNotFound}, false},
+		{"other", errors.New("boom"), false},
+	} {
+		if got := isRateLimited(tt.err); got != tt.want {
+			t.Errorf("%s: got %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRateLimitMessage(t *testing.T) {
+	// Docker Hub limits can be lifted with credentials, so say how.
+	if got := rateLimitMessage(name.MustParseReference("ubuntu")); !strings.Contains(got, "Docker Hub") || !strings.Contains(got, registryAuthHeader) {
+		t.Errorf("Docker Hub: got %q", got)
+	}
+	if got := rateLimitMessage(name.MustParseReference("ghcr.io/foo/bar")); !strings.HasPrefix(got, "ghcr.io ") {
+		t.Errorf("other registries: got %q", got)
+	}
+}
+
+func TestDockerHubKeychain(t *testing.T) {
+	auth := authn.FromConfig(authn.AuthConfig{Username: "me", Password: "token"})
+	kc := dockerHubKeychain{auth: auth}
+	for _, tt := range []struct {
+		ref  string
+		want authn.Authenticator
+	}{
+		{"ubuntu", auth},
+		{"docker.io/foo/bar", auth},
+		// The Docker Hub token mustn't be sent anywhere else.
+		{"ghcr.io/foo/bar", authn.Anonymous},
+	} {
+		ref, err := name.ParseReference(tt.ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := kc.Resolve(ref.Context())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.ref, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+// Error categories, so that API callers can react to a failure without
+// parsing its message.
+const (
+	categoryBadInput = "bad_input"
+	categoryNotFound = "not_found"
+	categoryUpstream = "upstream"
+	categoryTimeout  = "timeout"
+	categoryInternal = "internal"
+	categoryBusy     = "busy"
+)
+
+// requestError is a failed request as shown to the user.
+type requestError struct {
+	Category string `json:"category"`
+	Message  string `json:"message"`
+	// Registry is how the registry turned the request down, if it did.
+	Registry *registryError `json:"registry,omitempty"`
+}
+
+type registryError struct {
+	StatusCode int                    `json:"statusCode"`
+	Errors     []transport.Diagnostic `json:"errors,omitempty"`
+}
+
+// newRequestError describes err, which failed the request with the HTTP
+// status code.
+func newRequestError(code int, err error) *requestError {
+	e := &requestError{Category: categoryUpstream, Message: err.Error()}
+	switch code {
+	case http.StatusBadRequest, http.StatusForbidden, http.StatusMethodNotAllowed:
+		e.Category = categoryBadInput
+	case http.StatusNotFound:
+		e.Category = categoryNotFound
+	case http.StatusGatewayTimeout:
+		e.Category = categoryTimeout
+	case http.StatusServiceUnavailable:
+		e.Category = categoryBusy
+	}
+
+	// go-containerregistry's errors include the full request URL and the
+	// raw response body. Keep whatever context we added, and describe the
+	// registry's response in its place.
+	var terr *transport.Error
+	if errors.As(err, &terr) {
+		e.Registry = &registryError{StatusCode: terr.StatusCode, Errors: terr.Errors}
+		e.Message = strings.TrimSuffix(strings.TrimSuffix(e.Message, terr.Error()), ": ")
+		if e.Message != "" {
+			e.Message += ": "
+		}
+		e.Message += describeRegistryError(terr)
+	}
+	return e
+}
+
+// describeRegistryError summarizes the registry's response in terr, e.g.
+// "ghcr.io responded 404 Not Found (MANIFEST_UNKNOWN: manifest unknown)".
+func describeRegistryError(terr *transport.Error) string {
+	who := "the registry"
+	if terr.Request != nil {
+		who = terr.Request.URL.Host
+	}
+	msg := fmt.Sprintf("%s responded %d %s", who, terr.StatusCode, http.StatusText(terr.StatusCode))
+	var diags []string
+	for _, d := range terr.Errors {
+		s := string(d.Code)
+		if d.Message != "" {
+			s += ": " + d.Message
+		}
+		diags = append(diags, s)
+	}
+	if len(diags) > 0 {
+		msg += " (" + strings.Join(diags, "; ") + ")"
+	}
+	return msg
+}
+
+// Title is the heading of the error page.
+func (e *requestError) Title() string {
+	switch e.Category {
+	case categoryBadInput:
+		return "Invalid request"
+	case categoryNotFound:
+		return "Not found"
+	case categoryTimeout:
+		return "Timed out"
+	case categoryInternal:
+		return "Internal error"
+	case categoryBusy:
+		return "Server busy"
+	}
+	return "Registry error"
+}
+
+// writeError responds to r with err, which failed it with the HTTP status
+// code: as JSON to API callers, or as a page for browsers.
+func (s *server) writeError(w http.ResponseWriter, r *http.Request, code int, err error) {
+	s.writeRequestError(w, r, code, newRequestError(code, err))
+}
+
+func (s *server) writeRequestError(w http.ResponseWriter, r *http.Request, code int, e *requestError) {
+	if wantsJSON(r) || strings.HasPrefix(r.URL.Path, "/api/") {
+		writeJSON(w, code, struct {
+			Error *requestError `json:"error"`
+		}{e})
+		return
+	}
+	s.renderMarkdown(w, r, code, "error.md", struct {
+		Image string
+		*requestError
+	}{r.URL.Query().Get("image"), e})
+}
@@ -0,0 +1,289 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/secure-systems-lab/go-securesystemslib/dsse"
+	ctypes "github.com/sigstore/cosign/v2/pkg/types"
+)
+
+// newTestRegistry serves an in-memory registry (with referrers support) for
+// the duration of the test, returning its host.
+func newTestRegistry(t testing.TB) string {
+	return newTestRegistryWith(t, nil)
+}
+
+// newTestRegistryWith is newTestRegistry with the registry's handler wrapped
+// by wrap, e.g. to inject failures or delays.
+func newTestRegistryWith(t testing.TB, wrap func(http.Handler) http.Handler) string {
+	var h http.Handler = registry.New(registry.WithReferrersSupport(true), registry.Logger(log.New(io.Discard, "", 0)))
+	if wrap != nil {
+		h = wrap(h)
+	}
+	s := httptest.NewServer(h)
+	t.Cleanup(s.Close)
+	return strings.TrimPrefix(s.URL, "http://")
+}
+
+// newTestRepo is the repository foo/bar in a new test registry.
+func newTestRepo(t testing.TB) name.Repository {
+	t.Helper()
+	repo, err := name.NewRepository(newTestRegistry(t) + "/foo/bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+// newTestServer returns a server with the defaults main sets up, other than
+// anything that needs the environment or the network.
+func newTestServer() *server {
+	return &server{
+		timeout:   30 * time.Second,
+		budget:    500,
+		transport: remote.DefaultTransport,
+	}
+}
+
+// pushImage pushes a random image to ref, returning its digest.
+func pushImage(t testing.TB, ref name.Reference) name.Digest {
+	t.Helper()
+	img, err := random.Image(100, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pushManifest(t, ref, img)
+}
+
+// pushManifest pushes img or index to ref, returning its digest.
+func pushManifest(t testing.TB, ref name.Reference, m remote.Taggable) name.Digest {
+	t.Helper()
+	var err error
+	switch m := m.(type) {
+	case v1.ImageIndex:
+		err = remote.WriteIndex(ref, m)
+	case v1.Image:
+		err = remote.Write(ref, m)
+	default:
+		t.Fatalf("can't push %T", m)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := m.(interface{ Digest() (v1.Hash, error) }).Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ref.Context().Digest(d.String())
+}
+
+// pushIndex pushes an index of random images, one per platform, to ref,
+// returning its digest and the digests of its children by platform.
+func pushIndex(t testing.TB, ref name.Reference, platforms ...string) (name.Digest, map[string]name.Digest) {
+	t.Helper()
+	var idx v1.ImageIndex = empty.Index
+	children := map[string]name.Digest{}
+	for _, p := range platforms {
+		platform, err := v1.ParsePlatform(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := random.Image(100, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d, err := img.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		idx = mutate.AppendManifests(idx, mutate.IndexAddendum{Add: img, Descriptor: v1.Descriptor{Platform: platform}})
+		children[p] = ref.Context().Digest(d.String())
+	}
+	return pushManifest(t, ref, idx), children
+}
+
+// artifact builds an OCI manifest, as cosign does for signatures and
+// attestations, with the given layers.
+func artifact(t testing.TB, layers ...mutate.Addendum) v1.Image {
+	t.Helper()
+	img, err := mutate.Append(empty.Image, layers...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img = mutate.MediaType(img, types.OCIManifestSchema1)
+	return mutate.ConfigMediaType(img, types.OCIConfigJSON)
+}
+
+// referrer makes img refer to subject, returning it.
+func referrer(t testing.TB, img v1.Image, subject name.Digest) v1.Image {
+	t.Helper()
+	h, err := v1.NewHash(subject.DigestStr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mutate.Subject(img, v1.Descriptor{MediaType: types.OCIManifestSchema1, Digest: h}).(v1.Image)
+}
+
+// cosignTag is the tag cosign stores d's signatures ("sig"), attestations
+// ("att") etc. under.
+func cosignTag(d name.Digest, suffix string) name.Tag {
+	return d.Context().Tag(strings.Replace(d.DigestStr(), ":", "-", 1) + "." + suffix)
+}
+
+// signatureLayer is a cosign signature layer claiming to sign signed, with
+// the given annotations on top of an inline signature.
+func signatureLayer(signed name.Digest, annotations map[string]string) mutate.Addendum {
+	payload := fmt.Sprintf(`{"critical":{"identity":{"docker-reference":%q},"image":{"docker-manifest-digest":%q},"type":"cosign container image signature"},"optional":null}`, signed.Context().String(), signed.DigestStr())
+	a := map[string]string{signatureAnnotation: "MEUCIQ=="}
+	for k, v := range annotations {
+		a[k] = v
+	}
+	return mutate.Addendum{Layer: static.NewLayer([]byte(payload), ctypes.SimpleSigningMediaType), Annotations: a}
+}
+
+// attestationLayer is a cosign attestation layer: a DSSE envelope carrying an
+// in-toto statement about subject.
+func attestationLayer(t testing.TB, subject name.Digest, predicateType, predicate string, annotations map[string]string) mutate.Addendum {
+	t.Helper()
+	h, err := v1.NewHash(subject.DigestStr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stmt := fmt.Sprintf(`{"_type":"https://in-toto.io/Statement/v0.1","predicateType":%q,"subject":[{"name":%q,"digest":{%q:%q}}],"predicate":%s}`, predicateType, subject.Context().String(), h.Algorithm, h.Hex, predicate)
+	env, err := json.Marshal(dsse.Envelope{
+		PayloadType: "application/vnd.in-toto+json",
+		Payload:     base64.StdEncoding.EncodeToString([]byte(stmt)),
+		Signatures:  []dsse.Signature{{Sig: "MEUCIQ=="}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := map[string]string{"predicateType": predicateType}
+	for k, v := range annotations {
+		a[k] = v
+	}
+	return mutate.Addendum{Layer: static.NewLayer(env, "application/vnd.dsse.envelope.v1+json"), Annotations: a}
+}
+
+// rekorBundle is a dev.sigstore.cosign/bundle annotation for a Rekor entry
+// integrated at t.
+func rekorBundle(logIndex int64, t time.Time) string {
+	return fmt.Sprintf(`{"SignedEntryTimestamp":"","Payload":{"body":"","integratedTime":%d,"logIndex":%d,"logID":"c0d23d6ad406973f9559f3ba2d1ca01f84147d8ffc5b8445c224f98b9591801d"}}`, t.Unix(), logIndex)
+}
+
+// newTestCert self-signs tmpl, filling in whatever's needed to issue it.
+// Without a validity window, it's valid for ten minutes either side of now.
+func newTestCert(t testing.TB, tmpl *x509.Certificate) (*x509.Certificate, string) {
+	t.Helper()
+	cert, _ := createCert(t, tmpl, nil)
+	return cert, certPEM(cert)
+}
+
+// testCA issues certificates, standing in for Fulcio.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// newTestCA returns a root CA, or with a parent, an intermediate issued by it.
+func newTestCA(t testing.TB, parent *testCA) *testCA {
+	t.Helper()
+	cn := "sigstore"
+	if parent != nil {
+		cn = "sigstore-intermediate"
+	}
+	cert, key := createCert(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: cn},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, parent)
+	return &testCA{cert: cert, key: key}
+}
+
+// issue issues a code signing certificate from tmpl, returning it and its key.
+func (ca *testCA) issue(t testing.TB, tmpl *x509.Certificate) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	tmpl.KeyUsage = x509.KeyUsageDigitalSignature
+	tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning}
+	return createCert(t, tmpl, ca)
+}
+
+// createCert issues tmpl from parent, or self-signs it if parent is nil.
+func createCert(t testing.TB, tmpl *x509.Certificate, parent *testCA) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tmpl.SerialNumber == nil {
+		tmpl.SerialNumber = big.NewInt(1)
+	}
+	if tmpl.NotBefore.IsZero() {
+		tmpl.NotBefore = time.Now().Add(-10 * time.Minute)
+		tmpl.NotAfter = time.Now().Add(10 * time.Minute)
+	}
+	issuer, issuerKey := tmpl, k
+	if parent != nil {
+		issuer, issuerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, issuer, &k.PublicKey, issuerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, k
+}
+
+// renderTemplate executes the results template for out, returning the
+// markdown.
+func renderTemplate(t testing.TB, out *output) string {
+	t.Helper()
+	var b bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&b, "template.md", out); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
@@ -0,0 +1,88 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// tagObservation records that a tag pointed at Digest between FirstSeen and
+// LastSeen (as far as lookups made through this server can tell).
+type tagObservation struct {
+	Digest    string    `json:"digest"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+}
+
+// tagHistory is an in-memory record of the digests that tags have resolved to.
+// It only knows about lookups made since the server started, and forgets the
+// least recently seen tags once it is full.
+type tagHistory struct {
+	// depth is the number of digests to remember per tag.
+	depth int
+	// maxTags is the number of tags to remember.
+	maxTags int
+
+	mu   sync.Mutex
+	tags map[string][]tagObservation
+}
+
+func newTagHistory(depth, maxTags int) *tagHistory {
+	return &tagHistory{
+		depth:   depth,
+		maxTags: maxTags,
+		tags:    make(map[string][]tagObservation),
+	}
+}
+
+// record notes that tag resolved to digest at now, and returns the tag's
+// history, most recent first.
+func (h *tagHistory) record(tag, digest string, now time.Time) []tagObservation {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	obs, ok := h.tags[tag]
+	if !ok && len(h.tags) >= h.maxTags {
+		h.evict()
+	}
+	if len(obs) > 0 && obs[0].Digest == digest {
+		obs[0].LastSeen = now
+	} else {
+		obs = append([]tagObservation{{Digest: digest, FirstSeen: now, LastSeen: now}}, obs...)
+		if len(obs) > h.depth {
+			obs = obs[:h.depth]
+		}
+	}
+	h.tags[tag] = obs
+
+	out := make([]tagObservation, len(obs))
+	copy(out, obs)
+	return out
+}
+
+// evict drops the least recently seen tag. h.mu must be held.
+func (h *tagHistory) evict() {
+	var (
+		oldest string
+		seen   time.Time
+	)
+	for tag, obs := range h.tags {
+		if oldest == "" || obs[0].LastSeen.Before(seen) {
+			oldest, seen = tag, obs[0].LastSeen
+		}
+	}
+	delete(h.tags, oldest)
+}
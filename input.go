@@ -0,0 +1,54 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+)
+
+// pastedSchemes are prefixes people paste along with image references, as
+// used by browsers and other tools, which name.ParseReference would reject.
+var pastedSchemes = []string{"https://", "http://", "docker://", "oci://"}
+
+// normalizeImage cleans up an image reference as typed or pasted by a user,
+// and rejects input that's clearly not a reference before we go looking for
+// it.
+func normalizeImage(image string) (string, error) {
+	image = strings.TrimSpace(image)
+	if isLocalRef(image) {
+		return image, nil
+	}
+	for _, scheme := range pastedSchemes {
+		if len(image) >= len(scheme) && strings.EqualFold(image[:len(scheme)], scheme) {
+			image = image[len(scheme):]
+			break
+		}
+	}
+	image = strings.TrimSuffix(image, "/")
+
+	switch {
+	case image == "":
+		return "", errors.New("missing image reference")
+	case strings.IndexFunc(image, unicode.IsSpace) >= 0:
+		return "", errors.New("image references can't contain spaces")
+	case strings.ContainsAny(image, "?#"):
+		return "", errors.New("that looks like a web page URL, not an image reference (e.g. ghcr.io/owner/image:tag)")
+	case strings.HasPrefix(image, "hub.docker.com/"):
+		return "", errors.New("that's a Docker Hub web page, not an image reference; use the image name instead (e.g. library/ubuntu or owner/image)")
+	}
+	return image, nil
+}
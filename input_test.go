@@ -0,0 +1,78 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+func TestNormalizeImage(t *testing.T) {
+	for _, tt := range []struct {
+		in, want string
+	}{
+		{"ubuntu", "ubuntu"},
+		{"  ghcr.io/foo/bar:v1\n", "ghcr.io/foo/bar:v1"},
+		{"https://ghcr.io/foo/bar", "ghcr.io/foo/bar"},
+		{"HTTP://ghcr.io/foo/bar/", "ghcr.io/foo/bar"},
+		{"docker://library/ubuntu:22.04", "library/ubuntu:22.04"},
+		{"oci://registry.example.com/foo@sha256:abc", "registry.example.com/foo@sha256:abc"},
+	} {
+		got, err := normalizeImage(tt.in)
+		if err != nil {
+			t.Errorf("normalizeImage(%q): %v", tt.in, err)
+		} else if got != tt.want {
+			t.Errorf("normalizeImage(%q): got %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeImageRejects(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"   ",
+		"https://",
+		"ghcr.io/foo/bar baz",
+		"https://github.com/foo/bar/pkgs/container/bar?tag=v1",
+		"https://hub.docker.com/_/ubuntu",
+	} {
+		if _, err := normalizeImage(in); err == nil {
+			t.Errorf("normalizeImage(%q): want an error", in)
+		}
+	}
+}
+
+func TestShortNameInterpreted(t *testing.T) {
+	repo := newTestRepo(t)
+	d := pushImage(t, repo.Tag("latest"))
+	// Short names are qualified against the default registry, which is the
+	// test registry here rather than Docker Hub.
+	s := newTestServer()
+	s.nameOpts = []name.Option{name.WithDefaultRegistry(repo.RegistryStr())}
+
+	out, _, err := resolve(t, s, "  https://foo/bar ", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.ResolvedRef.Identifier() != d.DigestStr() {
+		t.Errorf("resolved to %s, want %s", out.ResolvedRef, d)
+	}
+	want := "Interpreted <code>foo/bar</code> as <code>" + repo.Tag("latest").Name() + "</code>"
+	if md := renderTemplate(t, out); !strings.Contains(md, want) {
+		t.Errorf("missing %q in:\n%s", want, md)
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	ecr "github.com/awslabs/amazon-ecr-credential-helper/ecr-login"
+	"github.com/chrismellard/docker-credential-acr-env/pkg/credhelper"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/v1/google"
+)
+
+// cloudKeychains are the keychains that authenticate to cloud registries with
+// the server's ambient identity, by the name CLOUD_KEYCHAINS knows them by.
+// They're constructed lazily, since some read their environment up front.
+var cloudKeychains = map[string]func() authn.Keychain{
+	// GCR and Artifact Registry, via application default credentials.
+	"google": func() authn.Keychain { return google.Keychain },
+	// ECR, via the AWS SDK's default credential chain.
+	"ecr": func() authn.Keychain {
+		return authn.NewKeychainFromHelper(ecr.NewECRHelper(ecr.WithLogger(io.Discard)))
+	},
+	// ACR, via the AZURE_* env vars of a service principal or workload
+	// identity.
+	"acr": func() authn.Keychain { return authn.NewKeychainFromHelper(credhelper.NewACRCredentialsHelper()) },
+}
+
+// parseCloudKeychains returns the keychains named in the comma separated list
+// names, e.g. "google,ecr".
+func parseCloudKeychains(names string) ([]authn.Keychain, error) {
+	var kcs []authn.Keychain
+	for _, n := range strings.Split(names, ",") {
+		n = strings.TrimSpace(n)
+		if n == "" {
+			continue
+		}
+		kc, ok := cloudKeychains[n]
+		if !ok {
+			return nil, fmt.Errorf("unknown keychain %q: must be one of google, ecr, acr", n)
+		}
+		kcs = append(kcs, kc())
+	}
+	return kcs, nil
+}
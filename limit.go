@@ -0,0 +1,81 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+var errTooManyLookups = errors.New("too many lookups in progress, try again later")
+
+// lookupLimiter bounds how many lookups run at once, so that a burst of
+// traffic doesn't turn into an unbounded number of registry requests.
+// Lookups beyond the limit wait in a queue of bounded depth. Once that's full
+// too, they're turned away.
+type lookupLimiter struct {
+	// admitted holds a token for every running or queued lookup.
+	admitted chan struct{}
+	// running holds a token for every running lookup.
+	running chan struct{}
+}
+
+func newLookupLimiter(concurrency, queueDepth int) *lookupLimiter {
+	return &lookupLimiter{
+		admitted: make(chan struct{}, concurrency+queueDepth),
+		running:  make(chan struct{}, concurrency),
+	}
+}
+
+// acquire waits for a lookup slot. It returns false without waiting if the
+// queue is full, or if ctx is done before a slot frees up.
+func (l *lookupLimiter) acquire(ctx context.Context) (release func(), ok bool) {
+	select {
+	case l.admitted <- struct{}{}:
+	default:
+		return nil, false
+	}
+	select {
+	case l.running <- struct{}{}:
+	case <-ctx.Done():
+		<-l.admitted
+		return nil, false
+	}
+	lookupsInFlight.Inc()
+	return func() {
+		lookupsInFlight.Dec()
+		<-l.running
+		<-l.admitted
+	}, true
+}
+
+// limited runs the lookup handler h under the server's lookup limiter, if
+// any.
+func (s *server) limited(h http.HandlerFunc) http.HandlerFunc {
+	if s.limiter == nil {
+		return h
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		release, ok := s.limiter.acquire(r.Context())
+		if !ok {
+			w.Header().Set("Retry-After", "5")
+			s.writeError(w, r, http.StatusServiceUnavailable, errTooManyLookups)
+			return
+		}
+		defer release()
+		h(w, r)
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLookupLimiter(t *testing.T) {
+	l := newLookupLimiter(1, 1)
+	release, ok := l.acquire(context.Background())
+	if !ok {
+		t.Fatal("first lookup wasn't admitted")
+	}
+
+	// The second lookup queues behind the first.
+	queued := make(chan func())
+	go func() {
+		r, ok := l.acquire(context.Background())
+		if !ok {
+			r = nil
+		}
+		queued <- r
+	}()
+	for len(l.admitted) != 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// With the queue full, the third is turned away without waiting.
+	if _, ok := l.acquire(context.Background()); ok {
+		t.Fatal("lookup admitted past the queue")
+	}
+
+	release()
+	select {
+	case r := <-queued:
+		if r == nil {
+			t.Fatal("queued lookup wasn't admitted")
+		}
+		r()
+	case <-time.After(5 * time.Second):
+		t.Fatal("queued lookup didn't start once the first finished")
+	}
+	if len(l.admitted) != 0 || len(l.running) != 0 {
+		t.Errorf("slots leaked: %d admitted, %d running", len(l.admitted), len(l.running))
+	}
+}
+
+func TestLookupLimiterCanceled(t *testing.T) {
+	l := newLookupLimiter(1, 1)
+	release, ok := l.acquire(context.Background())
+	if !ok {
+		t.Fatal("first lookup wasn't admitted")
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, ok := l.acquire(ctx); ok {
+		t.Fatal("lookup admitted while another was running")
+	}
+	// Giving up frees the queue slot.
+	if len(l.admitted) != 1 {
+		t.Errorf("got %d admitted, want 1", len(l.admitted))
+	}
+}
+
+func TestLimitedBusy(t *testing.T) {
+	s := newTestServer()
+	s.limiter = newLookupLimiter(1, 0)
+	release, ok := s.limiter.acquire(context.Background())
+	if !ok {
+		t.Fatal("first lookup wasn't admitted")
+	}
+	defer release()
+
+	h := s.limited(func(http.ResponseWriter, *http.Request) {
+		t.Error("handler ran past the limit")
+	})
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodGet, "/api/v1/lookup?image=foo", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status: got %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("no Retry-After header")
+	}
+	if !strings.Contains(w.Body.String(), errTooManyLookups.Error()) {
+		t.Errorf("body doesn't explain why:\n%s", w.Body)
+	}
+}
@@ -0,0 +1,242 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+)
+
+// Local images are referenced as:
+//
+//	oci-layout:///path/to/layout[:tag|@digest]
+//	tarball:///path/to/image.tar
+//
+// Rather than teach every lookup about local storage, the image (and anything
+// stored alongside it, e.g. by `cosign save`) is loaded into an in-memory
+// registry that the normal remote lookup then runs against.
+const (
+	schemeLayout  = "oci-layout://"
+	schemeTarball = "tarball://"
+
+	// localRepo is the repository local images are served from.
+	localRepo = "local.oci.fyi/image"
+)
+
+const (
+	// refNameAnnotation names a manifest in an OCI layout's index.
+	refNameAnnotation = "org.opencontainers.image.ref.name"
+
+	// Annotations `cosign save` uses to say what each manifest in a layout
+	// is.
+	cosignKindAnnotation       = "kind"
+	cosignImageAnnotation      = "dev.cosignproject.cosign/image"
+	cosignImageIndexAnnotation = "dev.cosignproject.cosign/imageIndex"
+	cosignSigsAnnotation       = "dev.cosignproject.cosign/sigs"
+	cosignAttsAnnotation       = "dev.cosignproject.cosign/atts"
+)
+
+func isLocalRef(s string) bool {
+	return strings.HasPrefix(s, schemeLayout) || strings.HasPrefix(s, schemeTarball)
+}
+
+// handlerTransport serves requests from an in-process handler.
+type handlerTransport struct {
+	h http.Handler
+}
+
+func (t *handlerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	// Handlers expect server requests, which always have a body.
+	if r.Body == nil {
+		r = r.Clone(r.Context())
+		r.Body = http.NoBody
+	}
+	rec := httptest.NewRecorder()
+	t.h.ServeHTTP(rec, r)
+	resp := rec.Result()
+	resp.Request = r
+	return resp, nil
+}
+
+// loadLocal loads the local image s into an in-memory registry, returning the
+// image's reference in it and the transport to reach it with.
+func loadLocal(s string) (name.Reference, http.RoundTripper, error) {
+	tr := &handlerTransport{h: registry.New(
+		registry.WithReferrersSupport(true),
+		registry.Logger(log.New(io.Discard, "", 0)),
+	)}
+	repo, err := name.NewRepository(localRepo)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var ref name.Reference
+	switch {
+	case strings.HasPrefix(s, schemeLayout):
+		ref, err = loadLayout(strings.TrimPrefix(s, schemeLayout), repo, remote.WithTransport(tr))
+	case strings.HasPrefix(s, schemeTarball):
+		ref, err = loadTarball(strings.TrimPrefix(s, schemeTarball), repo, remote.WithTransport(tr))
+	default:
+		err = fmt.Errorf("not a local image: %s", s)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return ref, tr, nil
+}
+
+// splitLocalRef splits a trailing :tag or @digest off of a local path. Only
+// the last path element is considered, so directories may contain colons.
+func splitLocalRef(s string) (path, tag, digest string) {
+	if p, d, ok := strings.Cut(s, "@"); ok {
+		return p, "", d
+	}
+	dir, base := "", s
+	if i := strings.LastIndex(s, "/"); i >= 0 {
+		dir, base = s[:i+1], s[i+1:]
+	}
+	if b, t, ok := strings.Cut(base, ":"); ok {
+		return dir + b, t, ""
+	}
+	return s, "", ""
+}
+
+func loadLayout(s string, repo name.Repository, opts ...remote.Option) (name.Reference, error) {
+	path, tag, digest := splitLocalRef(s)
+	p, err := layout.FromPath(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading oci layout: %w", err)
+	}
+	ii, err := p.ImageIndex()
+	if err != nil {
+		return nil, fmt.Errorf("error reading oci layout index: %w", err)
+	}
+	im, err := ii.IndexManifest()
+	if err != nil {
+		return nil, fmt.Errorf("error reading oci layout index: %w", err)
+	}
+
+	// Push everything first so that referrers are in place, then work out
+	// which manifest was asked for.
+	var (
+		subject *v1.Descriptor
+		named   = make(map[string]v1.Descriptor)
+		cosign  = make(map[string]v1.Descriptor)
+		others  []v1.Descriptor
+	)
+	for _, d := range im.Manifests {
+		target := repo.Digest(d.Digest.String())
+		switch {
+		case d.MediaType.IsIndex():
+			idx, err := ii.ImageIndex(d.Digest)
+			if err != nil {
+				return nil, fmt.Errorf("error reading %s: %w", d.Digest, err)
+			}
+			if err := remote.WriteIndex(target, idx, opts...); err != nil {
+				return nil, fmt.Errorf("error loading %s: %w", d.Digest, err)
+			}
+		case d.MediaType.IsImage():
+			img, err := ii.Image(d.Digest)
+			if err != nil {
+				return nil, fmt.Errorf("error reading %s: %w", d.Digest, err)
+			}
+			if err := remote.Write(target, img, opts...); err != nil {
+				return nil, fmt.Errorf("error loading %s: %w", d.Digest, err)
+			}
+		default:
+			continue
+		}
+
+		if n := d.Annotations[refNameAnnotation]; n != "" {
+			named[n] = d
+		}
+		switch k := d.Annotations[cosignKindAnnotation]; k {
+		case cosignImageAnnotation, cosignImageIndexAnnotation:
+			d := d
+			subject = &d
+		case cosignSigsAnnotation, cosignAttsAnnotation:
+			cosign[k] = d
+		default:
+			others = append(others, d)
+		}
+	}
+
+	var want v1.Descriptor
+	switch {
+	case digest != "":
+		h, err := v1.NewHash(digest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid digest: %w", err)
+		}
+		want.Digest = h
+	case tag != "":
+		d, ok := named[tag]
+		if !ok {
+			return nil, fmt.Errorf("no manifest named %q in oci layout", tag)
+		}
+		want = d
+	case subject != nil:
+		want = *subject
+	case len(others) == 1:
+		want = others[0]
+	default:
+		return nil, fmt.Errorf("oci layout has %d manifests: pick one with :<name> or @<digest>", len(im.Manifests))
+	}
+
+	// `cosign save` doesn't store signatures as referrers, so recreate the
+	// tags cosign would look for.
+	if subject != nil && subject.Digest == want.Digest {
+		prefix := strings.Replace(want.Digest.String(), ":", "-", 1)
+		for kind, suffix := range map[string]string{cosignSigsAnnotation: ".sig", cosignAttsAnnotation: ".att"} {
+			d, ok := cosign[kind]
+			if !ok {
+				continue
+			}
+			img, err := ii.Image(d.Digest)
+			if err != nil {
+				return nil, fmt.Errorf("error reading %s: %w", d.Digest, err)
+			}
+			if err := remote.Write(repo.Tag(prefix+suffix), img, opts...); err != nil {
+				return nil, fmt.Errorf("error loading %s: %w", d.Digest, err)
+			}
+		}
+	}
+	return repo.Digest(want.Digest.String()), nil
+}
+
+// loadTarball loads a `docker save` style tarball. Only single image tarballs
+// are supported.
+func loadTarball(path string, repo name.Repository, opts ...remote.Option) (name.Reference, error) {
+	img, err := tarball.ImageFromPath(path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error reading tarball: %w", err)
+	}
+	ref := repo.Tag("latest")
+	if err := remote.Write(ref, img, opts...); err != nil {
+		return nil, fmt.Errorf("error loading tarball: %w", err)
+	}
+	return ref, nil
+}
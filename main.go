@@ -16,104 +16,1104 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"io"
+	"html/template"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
-	"github.com/gomarkdown/markdown"
-	"github.com/gomarkdown/markdown/html"
-	"github.com/gomarkdown/markdown/parser"
 	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	ociremote "github.com/sigstore/cosign/v2/pkg/oci/remote"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/exp/slog"
 )
 
 const (
+	// defaultPage is the landing page, formatted with the (HTML escaped)
+	// example image.
 	defaultPage = `<html>
 <head>
 <link rel="stylesheet" href="https://cdn.simplecss.org/simple.min.css">
+` + faviconLink + `
 </head>
 <body>
 <h1 id="oci-fyi"><a href="/">oci.fyi</a></h1>
 <form action="/" method="GET" autocomplete="off" spellcheck="false">
-<input size="100" type="text" name="image" value="cgr.dev/chainguard/static">
+<input size="100" type="text" name="image" value="%s">
 <input type="submit">
 </form>
+<p><small>Results are cached for a while. Add <code>&amp;refresh=true</code> to the URL to look again, e.g. right after signing.</small></p>
 </body>
 </html>`
+
+	faviconLink = `<link rel="icon" type="image/svg+xml" href="/favicon.svg">`
 )
 
+type server struct {
+	nameOpts []name.Option
+	// sigRepo is where cosign's signature/attestation tags are stored, if not
+	// alongside the image.
+	sigRepo   *name.Repository
+	timeout   time.Duration
+	budget    int64
+	transport http.RoundTripper
+	// history records the digests tags have been seen to resolve to.
+	history *tagHistory
+	// staleAfter flags images whose newest signature is older than this, if
+	// set.
+	staleAfter time.Duration
+	// allowLocal permits inspecting images on the server's filesystem.
+	allowLocal bool
+	// allowShortDigests permits resolving repo@<digest prefix> by listing
+	// the repository's tags.
+	allowShortDigests bool
+	// keychain supplies the server's own registry credentials. It defaults
+	// to authn.DefaultKeychain.
+	keychain authn.Keychain
+	// listTags lists the tags that point at each image looked up, by
+	// resolving every tag in its repository.
+	listTags bool
+	// registries restricts which registries can be looked up in, if set.
+	registries *registryPolicy
+	// limiter bounds how many lookups run at once, if set.
+	limiter *lookupLimiter
+	// cache holds recent lookup results, if enabled.
+	cache *resultCache
+	// readyRegistry is dialed by /readyz, if set.
+	readyRegistry name.Registry
+	// exampleImage is shown on the landing page.
+	exampleImage string
+	// noLandingPage 404s requests to / without an image, rather than
+	// serving the lookup form.
+	noLandingPage bool
+	// maxPageSize caps the size of rendered pages, in bytes of markdown, if
+	// set.
+	maxPageSize int
+	// maxEntries is how many signatures, attestations etc. of each manifest
+	// are shown at a time, if set.
+	maxEntries int
+}
+
 func main() {
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		image := r.URL.Query().Get("image")
-		if image == "" {
-			w.Write([]byte(defaultPage))
-			return
+	// LOG_LEVEL is the minimum level logged, e.g. debug to also log every
+	// registry request.
+	var level slog.Level
+	if v := os.Getenv("LOG_LEVEL"); v != "" {
+		if err := level.UnmarshalText([]byte(v)); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid LOG_LEVEL %q: %v\n", v, err)
+			os.Exit(1)
 		}
-		// Render markdown, then pass to html/template.
-		// This was just easier to prototype than trying to deal with html/css.
-		ref, err := name.ParseReference(image)
+	}
+	logOpts := &slog.HandlerOptions{Level: level}
+	switch {
+	case os.Getenv("LOG_FORMAT") == "json":
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, logOpts)))
+	case level != slog.LevelInfo:
+		// The default handler only logs at info and above.
+		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, logOpts)))
+	}
+
+	// REGISTRY_CA_BUNDLE is a PEM file of extra CAs to trust when talking to
+	// registries, e.g. for private registries with an internal CA.
+	base := remote.DefaultTransport
+	if v := os.Getenv("REGISTRY_CA_BUNDLE"); v != "" {
+		t, err := caBundleTransport(v)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
+			slog.Error("invalid REGISTRY_CA_BUNDLE", "path", v, "error", err)
+			os.Exit(1)
 		}
-		b := new(bytes.Buffer)
-		if err := handleRef(b, ref); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+		base = t
+	}
+	// ALLOW_PRIVATE_REGISTRIES=true permits registries on private, loopback
+	// and link-local addresses, for on-prem deployments. Otherwise anyone
+	// could use the server to reach internal services.
+	if os.Getenv("ALLOW_PRIVATE_REGISTRIES") != "true" {
+		base = publicOnlyTransport(base.(*http.Transport))
+	}
+
+	s := &server{
+		timeout:      30 * time.Second,
+		budget:       500,
+		transport:    newReferrersTransport(&budgetTransport{base: &tracingTransport{base: base}}, time.Hour),
+		history:      newTagHistory(20, 10000),
+		exampleImage: "cgr.dev/chainguard/static",
+		// Large enough for images with hundreds of signatures, small enough
+		// that browsers don't choke on the page.
+		maxPageSize: 2 << 20,
+		maxEntries:  50,
+	}
+
+	// DEFAULT_TAG overrides the tag used when a reference has neither a tag nor
+	// a digest (normally "latest").
+	if tag := os.Getenv("DEFAULT_TAG"); tag != "" {
+		if _, err := name.NewTag("example.com/repo:"+tag, name.StrictValidation); err != nil {
+			slog.Error("invalid DEFAULT_TAG", "tag", tag, "error", err)
+			os.Exit(1)
+		}
+		s.nameOpts = append(s.nameOpts, name.WithDefaultTag(tag))
+	}
+
+	// COSIGN_REPOSITORY mirrors cosign's own setting for storing signatures in
+	// a different repository from the image.
+	if v := os.Getenv(ociremote.RepoOverrideEnvKey); v != "" {
+		repo, err := name.NewRepository(v)
+		if err != nil {
+			slog.Error("invalid "+ociremote.RepoOverrideEnvKey, "repository", v, "error", err)
+			os.Exit(1)
+		}
+		s.sigRepo = &repo
+	}
+
+	// LOOKUP_TIMEOUT bounds how long a single lookup may spend talking to
+	// registries.
+	if v := os.Getenv("LOOKUP_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			slog.Error("invalid LOOKUP_TIMEOUT", "timeout", v, "error", err)
+			os.Exit(1)
+		}
+		s.timeout = d
+	}
+
+	// REQUEST_BUDGET caps the number of registry requests a single lookup may
+	// make. 0 disables the limit.
+	if v := os.Getenv("REQUEST_BUDGET"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			slog.Error("invalid REQUEST_BUDGET", "budget", v, "error", err)
+			os.Exit(1)
+		}
+		s.budget = n
+	}
+
+	// CACHE_TTL and CACHE_SIZE configure the lookup result cache. A TTL of 0
+	// disables it.
+	cacheTTL, cacheSize := 5*time.Minute, 1000
+	if v := os.Getenv("CACHE_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			slog.Error("invalid CACHE_TTL", "ttl", v, "error", err)
+			os.Exit(1)
+		}
+		cacheTTL = d
+	}
+	if v := os.Getenv("CACHE_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			slog.Error("invalid CACHE_SIZE", "size", v, "error", err)
+			os.Exit(1)
+		}
+		cacheSize = n
+	}
+	if cacheTTL > 0 {
+		s.cache = newResultCache(cacheTTL, cacheSize)
+	}
+
+	// MAX_CONCURRENT_LOOKUPS bounds how many lookups run at once, with up to
+	// LOOKUP_QUEUE_DEPTH more waiting for a slot. A limit of 0 disables it.
+	concurrency, queueDepth := 32, 64
+	if v := os.Getenv("MAX_CONCURRENT_LOOKUPS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			slog.Error("invalid MAX_CONCURRENT_LOOKUPS", "limit", v, "error", err)
+			os.Exit(1)
+		}
+		concurrency = n
+	}
+	if v := os.Getenv("LOOKUP_QUEUE_DEPTH"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			slog.Error("invalid LOOKUP_QUEUE_DEPTH", "depth", v, "error", err)
+			os.Exit(1)
+		}
+		queueDepth = n
+	}
+	if concurrency > 0 {
+		s.limiter = newLookupLimiter(concurrency, queueDepth)
+	}
+
+	// EXAMPLE_IMAGE is prefilled on the landing page, e.g. to point users of a
+	// private instance at an internal image.
+	if v := os.Getenv("EXAMPLE_IMAGE"); v != "" {
+		s.exampleImage = v
+	}
+
+	// MAX_PAGE_SIZE caps rendered pages at this many bytes. 0 disables it.
+	if v := os.Getenv("MAX_PAGE_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			slog.Error("invalid MAX_PAGE_SIZE", "size", v, "error", err)
+			os.Exit(1)
+		}
+		s.maxPageSize = n
+	}
+
+	// MAX_ENTRIES is how many entries of each manifest are shown per page,
+	// with offset=N paging through the rest. 0 shows them all.
+	if v := os.Getenv("MAX_ENTRIES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			slog.Error("invalid MAX_ENTRIES", "entries", v, "error", err)
+			os.Exit(1)
+		}
+		s.maxEntries = n
+	}
+
+	// STALE_AFTER flags images that haven't been signed for a while.
+	if v := os.Getenv("STALE_AFTER"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			slog.Error("invalid STALE_AFTER", "duration", v, "error", err)
+			os.Exit(1)
 		}
-		if os.Getenv("DEBUG") != "" {
-			fmt.Println(b)
+		s.staleAfter = d
+	}
+
+	// ALLOW_LOCAL_IMAGES=true permits oci-layout:// and tarball:// images.
+	// This exposes the server's filesystem, so it's off by default.
+	s.allowLocal = os.Getenv("ALLOW_LOCAL_IMAGES") == "true"
+
+	// ALLOW_SHORT_DIGESTS=true permits images like repo@abc123def456.
+	// Resolving one means listing and resolving every tag in the
+	// repository, so it's off by default.
+	s.allowShortDigests = os.Getenv("ALLOW_SHORT_DIGESTS") == "true"
+
+	// DOCKERHUB_USERNAME and DOCKERHUB_TOKEN (an access token) authenticate
+	// docker.io lookups, which otherwise run into Docker Hub's anonymous
+	// rate limit.
+	var keychains []authn.Keychain
+	if user, token := os.Getenv("DOCKERHUB_USERNAME"), os.Getenv("DOCKERHUB_TOKEN"); user != "" && token != "" {
+		keychains = append(keychains, dockerHubKeychain{authn.FromConfig(authn.AuthConfig{Username: user, Password: token})})
+	}
+	keychains = append(keychains, authn.DefaultKeychain)
+	// CLOUD_KEYCHAINS (e.g. google,ecr,acr) also authenticates to those
+	// clouds' registries as whatever identity the server runs as.
+	if v := os.Getenv("CLOUD_KEYCHAINS"); v != "" {
+		kcs, err := parseCloudKeychains(v)
+		if err != nil {
+			slog.Error("invalid CLOUD_KEYCHAINS", "keychains", v, "error", err)
+			os.Exit(1)
 		}
+		keychains = append(keychains, kcs...)
+	}
+	if len(keychains) > 1 {
+		s.keychain = authn.NewMultiKeychain(keychains...)
+	}
 
-		// Render to HTML
-		p := parser.NewWithExtensions(parser.CommonExtensions | parser.AutoHeadingIDs | parser.NoEmptyLineBeforeBlock | parser.Tables)
-		doc := p.Parse(b.Bytes())
-		opts := html.RendererOptions{
-			Title: r.Host,
-			Flags: html.CommonFlags | html.HrefTargetBlank | html.CompletePage,
-			CSS:   "https://cdn.simplecss.org/simple.min.css",
+	// ALLOWED_REGISTRIES and DENIED_REGISTRIES restrict lookups to, or
+	// keep them away from, the listed registries (e.g. ghcr.io,*.gcr.io).
+	// They're checked before anything is fetched.
+	if allow, deny := os.Getenv("ALLOWED_REGISTRIES"), os.Getenv("DENIED_REGISTRIES"); allow != "" || deny != "" {
+		s.registries = new(registryPolicy)
+		var err error
+		if s.registries.allow, err = parseRegistryPatterns(allow); err != nil {
+			slog.Error("invalid ALLOWED_REGISTRIES", "registries", allow, "error", err)
+			os.Exit(1)
+		}
+		if s.registries.deny, err = parseRegistryPatterns(deny); err != nil {
+			slog.Error("invalid DENIED_REGISTRIES", "registries", deny, "error", err)
+			os.Exit(1)
 		}
-		renderer := html.NewRenderer(opts)
+	}
+
+	// GITHUB_ENTERPRISE_HOSTS lists GitHub Enterprise Server hosts (e.g.
+	// github.example.com), so that builds there link to commits and workflow
+	// files like those on github.com.
+	if v := os.Getenv("GITHUB_ENTERPRISE_HOSTS"); v != "" {
+		for _, h := range strings.Split(v, ",") {
+			h = strings.ToLower(strings.TrimSpace(h))
+			if h == "" || strings.ContainsAny(h, "/:") {
+				slog.Error("invalid GITHUB_ENTERPRISE_HOSTS", "host", h)
+				os.Exit(1)
+			}
+			githubEnterpriseHosts[h] = true
+		}
+	}
 
-		w.Write(markdown.Render(doc, renderer))
-	})
-	http.ListenAndServe(":8080", nil)
+	// LIST_TAGS=true shows which tags point at each image. Like short
+	// digests, that means resolving every tag in the repository, so it's off
+	// by default.
+	s.listTags = os.Getenv("LIST_TAGS") == "true"
+
+	// READY_REGISTRY makes /readyz check that the given registry is reachable.
+	if v := os.Getenv("READY_REGISTRY"); v != "" {
+		reg, err := name.NewRegistry(v)
+		if err != nil {
+			slog.Error("invalid READY_REGISTRY", "registry", v, "error", err)
+			os.Exit(1)
+		}
+		s.readyRegistry = reg
+	}
+
+	// Given an image, look it up once and exit rather than serving.
+	image := flag.String("image", "", "look up this image, print the report to stdout and exit")
+	format := flag.String("o", "markdown", "with -image, the report format: markdown, json, or term for a terminal")
+	asJSON := flag.Bool("json", false, "with -image, print the report as JSON (the same as -o json)")
+	flag.Parse()
+	if *asJSON {
+		*format = "json"
+	}
+	if *image != "" {
+		// Whoever is running the CLI already has access to the filesystem.
+		s.allowLocal = true
+		os.Exit(s.runCLI(context.Background(), os.Stdout, os.Stderr, *image, *format))
+	}
+
+	http.HandleFunc("/healthz", handleHealthz)
+	http.HandleFunc("/favicon.ico", handleFavicon)
+	http.HandleFunc("/favicon.svg", handleFavicon)
+	http.HandleFunc("/readyz", s.handleReadyz)
+	// DISABLE_LANDING_PAGE=true drops the lookup form for API-only
+	// deployments. Lookups on / (?image=...) still work, for links and
+	// clients that negotiate JSON there, but anything else 404s.
+	s.noLandingPage = os.Getenv("DISABLE_LANDING_PAGE") == "true"
+	http.HandleFunc("/", s.handleIndex)
+	http.HandleFunc("/api/v1", s.limited(s.handleAPI))
+	http.HandleFunc("/api/v1/diff", s.limited(s.handleDiff))
+	http.HandleFunc("/api/v1/summary", s.limited(s.handleSummary))
+	http.HandleFunc("/badge", s.limited(s.handleBadge))
+	http.HandleFunc("/compare", s.limited(s.handleCompare))
+	http.Handle("/metrics", promhttp.Handler())
+
+	// SHUTDOWN_GRACE_PERIOD is how long in-flight lookups get to finish once
+	// we've been asked to stop.
+	grace := 10 * time.Second
+	if v := os.Getenv("SHUTDOWN_GRACE_PERIOD"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			slog.Error("invalid SHUTDOWN_GRACE_PERIOD", "period", v, "error", err)
+			os.Exit(1)
+		}
+		grace = d
+	}
+
+	shutdownTracing, err := setupTracing(context.Background())
+	if err != nil {
+		slog.Error("failed to set up tracing", "error", err)
+		os.Exit(1)
+	}
+
+	srv := &http.Server{Addr: ":8080", Handler: logRequests(s.recoverPanics(http.DefaultServeMux))}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("failed to serve", "error", err)
+			os.Exit(1)
+		}
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	<-ctx.Done()
+
+	slog.Info("shutting down", "grace", grace)
+	ctx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Error("failed to shut down cleanly", "error", err)
+		os.Exit(1)
+	}
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Warn("failed to flush traces", "error", err)
+	}
+	slog.Info("shutdown complete")
 }
 
-func handleRef(w io.Writer, ref name.Reference) error {
-	opts := []remote.Option{remote.WithAuthFromKeychain(authn.DefaultKeychain)}
-	desc, err := remote.Head(ref, opts...)
+// handleIndex serves the landing page, or the results page if given an
+// image. Only the latter is a lookup.
+func (s *server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("image") == "" {
+		if s.noLandingPage {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, defaultPage, template.HTMLEscapeString(s.exampleImage))
+		return
+	}
+	s.limited(s.handlePage)(w, r)
+}
+
+func (s *server) handlePage(w http.ResponseWriter, r *http.Request) {
+	// The status depends on how the lookup went, so it has to finish before
+	// anything's sent. The page is then streamed a section at a time.
+	out, code, err := s.lookup(r)
+	if err != nil {
+		s.writeError(w, r, code, err)
+		return
+	}
+	if writeRaw(w, r, code, out) {
+		return
+	}
+	if wantsJSON(r) {
+		writeJSON(w, code, toAPI(out))
+		return
+	}
+	s.renderMarkdown(w, r, code, "template.md", out)
+}
+
+// renderMarkdown renders the named markdown template with data as an HTML
+// page.
+func (s *server) renderMarkdown(w http.ResponseWriter, r *http.Request, code int, name string, data any) {
+	s.startPage(w, r, code).render(name, data)
+}
+
+// truncateMarkdown cuts b down to at most keep bytes, plus a notice that the
+// page was truncated at max bytes. It cuts at a line boundary where it can,
+// so the last line of markdown is still whole.
+func truncateMarkdown(b *bytes.Buffer, keep, max int) {
+	n := keep
+	if i := bytes.LastIndexByte(b.Bytes()[:keep], '\n'); i > 0 {
+		n = i + 1
+	}
+	b.Truncate(n)
+	fmt.Fprintf(b, "\n\n<blockquote>⚠️ <b>Output truncated</b> at %d bytes. The JSON API (<code>/api/v1</code>) has the full results.</blockquote>\n", max)
+}
+
+// handleFavicon serves the embedded favicon. Browsers ask for /favicon.ico
+// regardless of what the page links to, so it's served there too.
+func handleFavicon(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Write(favicon)
+}
+
+// handleHealthz reports that the server is up. It deliberately doesn't touch
+// any registries.
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("ok"))
+}
+
+// handleReadyz reports whether the server can reach its configured registry.
+// This only checks that a TCP connection can be made, so that probes don't eat
+// into registry rate limits.
+func (s *server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if s.readyRegistry.RegistryStr() == "" {
+		w.Write([]byte("ok"))
+		return
+	}
+	addr := s.readyRegistry.RegistryStr()
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		// No explicit port, so use the scheme's default.
+		addr = net.JoinHostPort(addr, s.readyRegistry.Scheme())
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+	conn, err := new(net.Dialer).DialContext(ctx, "tcp", addr)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("registry %s unreachable: %v", addr, err), http.StatusServiceUnavailable)
+		return
+	}
+	conn.Close()
+	w.Write([]byte("ok"))
+}
+
+func (s *server) handleAPI(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("image") == "" {
+		s.writeError(w, r, http.StatusBadRequest, errors.New("missing image parameter"))
+		return
+	}
+	out, code, err := s.lookup(r)
+	if err != nil {
+		s.writeError(w, r, code, err)
+		return
+	}
+	if writeRaw(w, r, code, out) {
+		return
+	}
+	writeJSON(w, code, toAPI(out))
+}
+
+// handleSummary serves the provenance summary of the requested image, for
+// ingestion into other systems.
+func (s *server) handleSummary(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("image") == "" {
+		s.writeError(w, r, http.StatusBadRequest, errors.New("missing image parameter"))
+		return
+	}
+	out, code, err := s.lookup(r)
+	if err != nil {
+		s.writeError(w, r, code, err)
+		return
+	}
+	writeJSON(w, code, toSummary(out, time.Now()))
+}
+
+// handleDiff compares the requested image against a baseline report (as
+// previously returned by /api/v1) POSTed in the request body.
+func (s *server) handleDiff(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		s.writeError(w, r, http.StatusMethodNotAllowed, errors.New("baseline report must be POSTed"))
+		return
+	}
+	if r.URL.Query().Get("image") == "" {
+		s.writeError(w, r, http.StatusBadRequest, errors.New("missing image parameter"))
+		return
+	}
+	baseline := new(apiOutput)
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(baseline); err != nil {
+		s.writeError(w, r, http.StatusBadRequest, fmt.Errorf("error decoding baseline report: %w", err))
+		return
+	}
+	out, code, err := s.lookup(r)
+	if err != nil {
+		s.writeError(w, r, code, err)
+		return
+	}
+	// The baseline has to be compared against everything, not a page.
+	out.Page = nil
+	writeJSON(w, code, diffReports(baseline, toAPI(out)))
+}
+
+// lookup resolves the image requested by r. On failure, the HTTP status code
+// that best describes the error is returned alongside it.
+//
+// If r sets strict=true and the image doesn't match the expected digest or
+// lacks a required attestation, the output is still returned but with a 412
+// status.
+func (s *server) lookup(r *http.Request) (*output, int, error) {
+	start := time.Now()
+	out, code, err := s.resolve(r)
+	observeLookup(code, time.Since(start))
+	recordOutcome(r.Context(), outcomeOf(code))
+	return out, code, err
+}
+
+func (s *server) resolve(r *http.Request) (*output, int, error) {
+	var (
+		ref       name.Reference
+		local     http.RoundTripper
+		shortRepo name.Repository
+		prefix    string
+		err       error
+	)
+	image, err := normalizeImage(r.URL.Query().Get("image"))
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	if isLocalRef(image) {
+		if !s.allowLocal {
+			return nil, http.StatusForbidden, errors.New("local images are disabled on this server")
+		}
+		ref, local, err = loadLocal(image)
+	} else if repo, p, ok := splitShortDigest(image); ok {
+		if !s.allowShortDigests {
+			return nil, http.StatusBadRequest, fmt.Errorf("short digests are disabled on this server, use the full digest of %s", image)
+		}
+		shortRepo, err = name.NewRepository(repo, s.nameOpts...)
+		prefix = p
+	} else {
+		ref, err = name.ParseReference(image, s.nameOpts...)
+	}
 	if err != nil {
-		return fmt.Errorf("error getting remote image: %w", err)
+		return nil, http.StatusBadRequest, err
+	}
+	if local == nil {
+		reg := shortRepo.Registry
+		if ref != nil {
+			reg = ref.Context().Registry
+		}
+		if err := s.registries.checkRegistry(reg); err != nil {
+			return nil, http.StatusForbidden, err
+		}
+	}
+
+	var expect v1.Hash
+	if e := r.URL.Query().Get("expect"); e != "" {
+		expect, err = v1.NewHash(e)
+		if err != nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("invalid expected digest: %w", err)
+		}
+	}
+
+	var slsaRequired *int
+	if v := r.URL.Query().Get("slsa"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > maxSLSALevel {
+			return nil, http.StatusBadRequest, fmt.Errorf("invalid SLSA build level %q: must be 0-%d", v, maxSLSALevel)
+		}
+		slsaRequired = &n
+	}
+
+	var predicateType string
+	if v := r.URL.Query().Get("predicateType"); v != "" {
+		if predicateType, err = parsePredicateType(v); err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+	}
+	var required []string
+	for _, v := range r.URL.Query()["require"] {
+		t, err := parsePredicateType(v)
+		if err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+		required = append(required, t)
+	}
+
+	offset := 0
+	if v := r.URL.Query().Get("offset"); v != "" {
+		if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+			return nil, http.StatusBadRequest, fmt.Errorf("invalid offset %q: must be a non-negative number", v)
+		}
 	}
 
-	sigDigest, sigData, err := getSignature(ref, opts...)
+	// signatureRepo overrides COSIGN_REPOSITORY, for images whose
+	// signatures are stored elsewhere.
+	sigRepo := s.sigRepo
+	if v := r.URL.Query().Get("signatureRepo"); v != "" {
+		repo, err := name.NewRepository(v, s.nameOpts...)
+		if err != nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("invalid signature repository: %w", err)
+		}
+		if err := s.registries.checkRegistry(repo.Registry); err != nil {
+			return nil, http.StatusForbidden, err
+		}
+		sigRepo = &repo
+	}
+
+	auth, err := requestAuth(r)
 	if err != nil {
-		slog.Warn("%v", err)
+		return nil, http.StatusBadRequest, err
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.timeout)
+	defer cancel()
+	ctx = withBudget(ctx, s.budget)
+
+	lo := lookupOptions{
+		raw:       r.URL.Query().Get("raw") == "true",
+		verify:    r.URL.Query().Get("verify") == "true",
+		refresh:   r.URL.Query().Get("refresh") == "true",
+		discovery: discoveryBoth,
+		sigRepo:   sigRepo,
+		cache:     s.cache,
+		keychain:  s.keychain,
+		auth:      auth,
+		remote:    []remote.Option{remote.WithTransport(s.transport)},
+	}
+	if local != nil {
+		lo.remote = []remote.Option{remote.WithTransport(local)}
+	}
+	// Don't share results fetched with someone's credentials.
+	if auth != nil {
+		lo.cache = nil
+	}
+	if p := r.URL.Query().Get("platform"); p != "" {
+		lo.platform, err = v1.ParsePlatform(p)
+		if err != nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("invalid platform: %w", err)
+		}
+	}
+	if d := r.URL.Query().Get("discovery"); d != "" {
+		switch d {
+		case discoveryTag, discoveryReferrers, discoveryBoth:
+			lo.discovery = d
+		default:
+			return nil, http.StatusBadRequest, fmt.Errorf("unknown discovery mode %q: must be one of %s, %s, %s", d, discoveryTag, discoveryReferrers, discoveryBoth)
+		}
 	}
 
-	attDigest, attData, err := getAttestations(ref, opts...)
+	if prefix != "" {
+		ref, err = resolveShortDigest(ctx, shortRepo, prefix, lo.remoteOptions(ctx)...)
+		switch {
+		case errors.Is(err, context.DeadlineExceeded):
+			return nil, http.StatusGatewayTimeout, fmt.Errorf("timed out after %s resolving digest prefix: %w", s.timeout, err)
+		case errors.Is(err, errDigestNotFound):
+			return nil, http.StatusNotFound, err
+		case err != nil:
+			return nil, http.StatusBadRequest, err
+		}
+	}
+
+	out, err := handleRef(ctx, ref, lo)
 	if err != nil {
-		slog.Warn("%v", err)
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, http.StatusGatewayTimeout, fmt.Errorf("timed out after %s waiting for the registry: %w", s.timeout, err)
+		}
+		if errors.Is(err, errPlatformNotFound) || isNotFound(err) {
+			return nil, http.StatusNotFound, err
+		}
+		if errors.Is(err, errPrivateAddress) {
+			return nil, http.StatusForbidden, err
+		}
+		if isRateLimited(err) {
+			return nil, http.StatusTooManyRequests, fmt.Errorf("%s: %w", rateLimitMessage(ref), err)
+		}
+		return nil, http.StatusInternalServerError, err
+	}
+
+	if _, ok := ref.(name.Tag); ok && local == nil {
+		out.Permalink = permalink(r.URL, out, s.nameOpts...)
+	}
+	if t, ok := ref.(name.Tag); ok && s.history != nil && local == nil {
+		// The tag points at the index, not the platform we pinned to.
+		resolved := out.ResolvedRef
+		if out.IndexRef != nil {
+			resolved = out.IndexRef
+		}
+		out.History = s.history.record(t.String(), resolved.Identifier(), time.Now().UTC())
+	}
+	if s.listTags && local == nil {
+		// As above, tags point at the index rather than the platform.
+		resolved := out.ResolvedRef
+		if out.IndexRef != nil {
+			resolved = out.IndexRef
+		}
+		tags, err := tagsOf(ctx, resolved.Context(), resolved.Identifier(), lo.remoteOptions(ctx)...)
+		if err != nil {
+			slog.Warn("failed to list tags", "ref", resolved.String(), "error", err)
+		}
+		out.Tags = tags
+	}
+	// metadata=true also reads the image config, which is one more blob to
+	// fetch. An index has no config of its own.
+	if r.URL.Query().Get("metadata") == "true" && !out.Index {
+		md, err := getMetadata(out.ResolvedRef, lo.remoteOptions(ctx)...)
+		if err != nil {
+			slog.Warn("failed to fetch image metadata", "ref", out.ResolvedRef.String(), "error", err)
+		} else {
+			md.crossCheck(out)
+			out.Metadata = md
+		}
+	}
+	// Local refs are rewritten to a fake registry, which isn't worth
+	// pointing out.
+	if local == nil {
+		out.Input = image
 	}
 
-	return tmpl.ExecuteTemplate(w, "template.md", &output{
+	if t := lastSigned(out); !t.IsZero() {
+		out.LastSigned = t
+		out.Stale = s.staleAfter > 0 && time.Since(t) > s.staleAfter
+	}
+
+	failed := false
+	if expect != (v1.Hash{}) {
+		out.Expected = expect.String()
+		out.Match = out.ResolvedRef.Identifier() == out.Expected
+		failed = !out.Match
+	}
+	if len(required) > 0 {
+		out.Policy = checkRequired(out, required)
+		failed = failed || !out.Policy.Pass
+	}
+	out.SLSA = bestSLSALevel(out)
+	if slsaRequired != nil {
+		if out.SLSA == nil {
+			out.SLSA = slsaLevel(&SignatureData{})
+		}
+		out.SLSA.Required = slsaRequired
+		failed = failed || !out.SLSA.Pass()
+	}
+	// Only filter what's shown: the checks above still consider every
+	// attestation.
+	if predicateType != "" {
+		out = filterPredicateType(out, predicateType)
+	}
+	if s.maxEntries > 0 {
+		out.Page = newPage(out, r.URL, offset, s.maxEntries)
+	}
+	if failed && r.URL.Query().Get("strict") == "true" {
+		return out, http.StatusPreconditionFailed, nil
+	}
+	return out, http.StatusOK, nil
+}
+
+// permalink returns u with the image pinned to the digest out resolved to,
+// or "" if that doesn't parse back to the same digest. With a platform, the
+// index's digest is used, so the platform is still picked from it.
+func permalink(u *url.URL, out *output, opts ...name.Option) string {
+	d := out.ResolvedRef
+	if out.IndexRef != nil {
+		d = out.IndexRef
+	}
+	image := d.Context().Digest(d.Identifier()).String()
+	if ref, err := name.ParseReference(image, opts...); err != nil || ref.Identifier() != d.Identifier() {
+		return ""
+	}
+	q := u.Query()
+	q.Set("image", image)
+	q.Del("refresh")
+	return u.Path + "?" + q.Encode()
+}
+
+const (
+	// discoveryTag finds signatures/attestations via cosign's tag scheme
+	// (e.g. sha256-<digest>.sig).
+	discoveryTag = "tag"
+	// discoveryReferrers finds artifacts via the OCI 1.1 referrers API.
+	discoveryReferrers = "referrers"
+	discoveryBoth      = "both"
+)
+
+// lookupOptions are the per-request knobs for handleRef.
+type lookupOptions struct {
+	raw bool
+	// verify enables (expensive) cryptographic verification of signatures.
+	verify    bool
+	discovery string
+	// sigRepo overrides the repository cosign's tags are looked up in.
+	sigRepo *name.Repository
+	// cache to reuse results from, if set.
+	cache *resultCache
+	// refresh refetches results unless they're very recent, but still
+	// caches them.
+	refresh bool
+	// keychain is the server's own credentials, if not authn.DefaultKeychain.
+	keychain authn.Keychain
+	// auth overrides the server's own credentials, if set.
+	auth authn.Authenticator
+	// platform picks which child of an index is inspected, if set.
+	platform *v1.Platform
+	// remote options to use in addition to the defaults.
+	remote []remote.Option
+}
+
+// ociOptions returns the options for locating cosign's tags.
+func (lo lookupOptions) ociOptions() []ociremote.Option {
+	if lo.sigRepo == nil {
+		return nil
+	}
+	return []ociremote.Option{ociremote.WithTargetRepository(*lo.sigRepo)}
+}
+
+// remoteOptions returns the options for talking to the registry.
+func (lo lookupOptions) remoteOptions(ctx context.Context) []remote.Option {
+	var kc authn.Keychain = authn.DefaultKeychain
+	if lo.keychain != nil {
+		kc = lo.keychain
+	}
+	auth := remote.WithAuthFromKeychain(kc)
+	if lo.auth != nil {
+		auth = remote.WithAuth(lo.auth)
+	}
+	return append([]remote.Option{remote.WithContext(ctx), auth}, lo.remote...)
+}
+
+func handleRef(ctx context.Context, ref name.Reference, lo lookupOptions) (*output, error) {
+	ctx, span := tracer.Start(ctx, "handleRef", trace.WithAttributes(attribute.String("ref", ref.String())))
+	defer span.End()
+
+	opts := lo.remoteOptions(ctx)
+	desc, err := remote.Head(ref, opts...)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("error getting remote image: %w", err)
+	}
+	resolved := ref.Context().Digest(desc.Digest.String())
+	span.SetAttributes(attribute.String("digest", resolved.DigestStr()))
+	index := desc.MediaType.IsIndex()
+
+	// Attestations are usually attached per platform, so if the caller asked
+	// for one, inspect that platform's image in place of the index.
+	var (
+		platform string
+		indexRef name.Reference
+	)
+	if index && lo.platform != nil {
+		child, err := pinPlatform(resolved, *lo.platform, opts...)
+		if err != nil {
+			return nil, err
+		}
+		platform, indexRef = lo.platform.String(), resolved
+		resolved, index = child, false
+	}
+
+	key := fmt.Sprintf("%s discovery=%s verify=%t", resolved, lo.discovery, lo.verify)
+	if lo.sigRepo != nil {
+		key += " sigRepo=" + lo.sigRepo.String()
+	}
+	if lo.cache != nil {
+		if c, ok := lo.cache.get(key, time.Now(), lo.refresh); ok {
+			out := &output{
+				Ref:         ref,
+				ResolvedRef: resolved,
+				Raw:         lo.raw,
+				Platform:    platform,
+				IndexRef:    indexRef,
+				Index:       c.index,
+				Groups:      c.groups,
+			}
+			out.Verdict = verdictOf(out)
+			return out, nil
+		}
+	}
+
+	root := &group{Ref: resolved}
+	root.Data, root.ReferrersIndex = getManifests(ctx, resolved, lo, opts...)
+	groups := []*group{root}
+
+	// Signatures and attestations are frequently attached to the individual
+	// platform images rather than (or in addition to) the index, so look at
+	// each child too.
+	if index {
+		im, children, err := getChildren(resolved, opts...)
+		if err != nil {
+			slog.Warn("failed to fetch index", "ref", resolved.String(), "error", err)
+		} else {
+			groups[0].Annotations = im.Annotations
+			groups[0].Subject = im.Subject
+		}
+		for _, c := range children {
+			g := &group{
+				Platform: childLabel(c),
+				Artifact: !hasPlatform(c),
+				Ref:      ref.Context().Digest(c.Digest.String()),
+			}
+			g.Data, g.ReferrersIndex = getManifests(ctx, g.Ref, lo, opts...)
+			groups = append(groups, g)
+		}
+	}
+
+	// Don't render partial results if we ran out of time part way through.
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	out := &output{
 		Ref:         ref,
-		ResolvedRef: ref.Context().Digest(desc.Digest.String()),
-		Data: []*manifest{
-			{
-				Name:   "Signatures",
-				Digest: sigDigest.String(),
-				Data:   sigData,
-			},
-			{
-				Name:   "Attestations",
-				Digest: attDigest.String(),
-				Data:   attData,
-			},
-		},
-	})
+		ResolvedRef: resolved,
+		Raw:         lo.raw,
+		Partial:     budgetExceeded(ctx),
+		Platform:    platform,
+		IndexRef:    indexRef,
+		Index:       index,
+		Groups:      groups,
+	}
+	out.Verdict = verdictOf(out)
+	// Partial or failed results would hide signatures for the lifetime of the
+	// entry.
+	if lo.cache != nil && !out.Partial && !hasErrors(groups) {
+		lo.cache.put(key, &cachedResult{index: index, groups: groups}, time.Now())
+	}
+	return out, nil
+}
+
+// hasErrors reports whether any manifest in groups failed to be fetched.
+func hasErrors(groups []*group) bool {
+	for _, g := range groups {
+		for _, m := range g.Data {
+			if m.Error != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// getManifests fetches the signature, attestation and SBOM manifests for digest
+// using the requested discovery mode. Failures are recorded on the affected
+// manifest rather than returned, so one bad tag doesn't hide the rest. The
+// referrers index the registry returned is also returned, if referrers were
+// looked up.
+func getManifests(ctx context.Context, digest name.Digest, lo lookupOptions, opts ...remote.Option) ([]*manifest, []byte) {
+	var out []*manifest
+	var referrersIndex []byte
+	if lo.discovery != discoveryReferrers {
+		ro := lo.ociOptions()
+		sigs, err := getSignature(ctx, digest, ro, opts...)
+		if err != nil {
+			slog.Warn("failed to fetch signatures", "ref", digest.String(), "error", err)
+			sigs.Error = err.Error()
+		}
+
+		atts, err := getAttestations(ctx, digest, ro, opts...)
+		if err != nil {
+			slog.Warn("failed to fetch attestations", "ref", digest.String(), "error", err)
+			atts.Error = err.Error()
+		}
+
+		sboms, err := getSBOM(ctx, digest, ro, opts...)
+		if err != nil {
+			slog.Warn("failed to fetch sboms", "ref", digest.String(), "error", err)
+			sboms.Error = err.Error()
+		}
+
+		if lo.verify {
+			if len(sigs.Data) > 0 {
+				verifySignatures(ctx, digest, sigs, ro, opts...)
+			}
+			if len(atts.Data) > 0 {
+				verifyAttestations(ctx, digest, atts, ro, opts...)
+			}
+			for _, m := range []*manifest{sigs, atts} {
+				for _, sd := range m.Data {
+					verifySCT(ctx, sd)
+					verifyTlog(ctx, sd)
+				}
+			}
+		}
+
+		if lo.discovery == discoveryBoth {
+			for _, m := range []*manifest{sigs, atts, sboms} {
+				for _, sd := range m.Data {
+					sd.Discovery = discoveryTag
+				}
+			}
+		}
+
+		sigs.Name = "Signatures"
+		atts.Name = "Attestations"
+		sboms.Name = "SBOMs"
+		out = append(out, sigs, atts, sboms)
+	}
+
+	if lo.discovery != discoveryTag {
+		refs, rawIndex, err := getReferrers(ctx, digest, opts...)
+		referrersIndex = rawIndex
+		if err != nil {
+			slog.Warn("failed to fetch referrers", "ref", digest.String(), "error", err)
+			out = append(out, &manifest{Name: "Referrers", Error: err.Error()})
+		}
+		// Some tools write both the cosign tags and referrers for the same
+		// signatures, so only show each one once (under its tag-based
+		// manifest), noting that both methods found it.
+		seen := make(map[string]*SignatureData)
+		for _, m := range out {
+			for _, sd := range m.Data {
+				seen[digestOf(sd.Layer.String())] = sd
+			}
+		}
+		for _, m := range refs {
+			var unique []*SignatureData
+			for _, sd := range m.Data {
+				if dup, ok := seen[digestOf(sd.Layer.String())]; ok {
+					if lo.discovery == discoveryBoth {
+						dup.Discovery = discoveryBoth
+					}
+					continue
+				}
+				if lo.discovery == discoveryBoth {
+					sd.Discovery = discoveryReferrers
+				}
+				unique = append(unique, sd)
+			}
+			if len(m.Data) > 0 && len(unique) == 0 {
+				continue
+			}
+			m.Data = unique
+			out = append(out, m)
+		}
+	}
+
+	for _, m := range out {
+		for _, sd := range m.Data {
+			sd.DigestMismatch = sd.SignedDigest != "" && sd.SignedDigest != digest.DigestStr()
+		}
+	}
+	return out, referrersIndex
 }
@@ -0,0 +1,402 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// resolve looks up image with the query params q through s, as the handlers
+// do.
+func resolve(t *testing.T, s *server, image string, q url.Values) (*output, int, error) {
+	t.Helper()
+	if q == nil {
+		q = url.Values{}
+	}
+	q.Set("image", image)
+	return s.resolve(httptest.NewRequest(http.MethodGet, "/?"+q.Encode(), nil))
+}
+
+func TestResolveTimeout(t *testing.T) {
+	// The registry serves the image, but hangs fetching its signatures.
+	release := make(chan struct{})
+	host := newTestRegistryWith(t, func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasSuffix(r.URL.Path, ".sig") {
+				select {
+				case <-r.Context().Done():
+				case <-release:
+				}
+				return
+			}
+			h.ServeHTTP(w, r)
+		})
+	})
+	t.Cleanup(func() { close(release) })
+	repo, err := name.NewRepository(host + "/foo/bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := pushImage(t, repo.Tag("latest"))
+
+	s := newTestServer()
+	s.timeout = 50 * time.Millisecond
+	_, code, err := resolve(t, s, d.String(), nil)
+	if code != http.StatusGatewayTimeout {
+		t.Errorf("status: got %d (%v), want %d", code, err, http.StatusGatewayTimeout)
+	}
+}
+
+// manifestNamed returns g's manifest called name, e.g. "Signatures".
+func manifestNamed(t *testing.T, g *group, name string) *manifest {
+	t.Helper()
+	for _, m := range g.Data {
+		if m.Name == name {
+			return m
+		}
+	}
+	t.Fatalf("%s has no %s", g.Ref, name)
+	return nil
+}
+
+func TestHandleRefIndex(t *testing.T) {
+	repo := newTestRepo(t)
+	idx, children := pushIndex(t, repo.Tag("latest"), "linux/amd64", "linux/arm64")
+	arm := children["linux/arm64"]
+	pushManifest(t, cosignTag(arm, "att"), artifact(t, attestationLayer(t, arm, "https://slsa.dev/provenance/v1", `{}`, nil)))
+
+	out, err := handleRef(context.Background(), idx, lookupOptions{discovery: discoveryTag})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !out.Index || len(out.Groups) != 3 {
+		t.Fatalf("want the index and a group per platform, got %d groups", len(out.Groups))
+	}
+	want := map[string]int{"": 0, "linux/amd64": 0, "linux/arm64": 1}
+	for _, g := range out.Groups {
+		n, ok := want[g.Platform]
+		if !ok {
+			t.Errorf("unexpected group %q", g.Platform)
+			continue
+		}
+		if got := len(manifestNamed(t, g, "Attestations").Data); got != n {
+			t.Errorf("%q: got %d attestations, want %d", g.Platform, got, n)
+		}
+	}
+	if !out.Verdict.Attested {
+		t.Error("index isn't attested, despite its arm64 image being")
+	}
+}
+
+// withTokenAuth makes the registry h require a bearer token whose scopes
+// cover each repository read, as Docker Hub and GHCR do. It records the scopes
+// tokens were requested for.
+func withTokenAuth(h http.Handler, scopes *[]string) http.Handler {
+	var mu sync.Mutex
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			q := r.URL.Query()["scope"]
+			mu.Lock()
+			*scopes = append(*scopes, q...)
+			mu.Unlock()
+			json.NewEncoder(w).Encode(map[string]string{"token": strings.Join(q, " ")})
+			return
+		}
+		token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		repo, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/v2/"), "/manifests/")
+		repo, _, _ = strings.Cut(repo, "/blobs/")
+		ok := token != ""
+		if r.URL.Path != "/v2/" {
+			ok = slices.Contains(strings.Fields(token), "repository:"+repo+":pull")
+		}
+		if !ok {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="http://%s/token",service="test"`, r.Host))
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func TestHandleRefSignatureRepoScope(t *testing.T) {
+	var (
+		auth   atomic.Bool
+		scopes []string
+	)
+	host := newTestRegistryWith(t, func(h http.Handler) http.Handler {
+		scoped := withTokenAuth(h, &scopes)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if auth.Load() {
+				scoped.ServeHTTP(w, r)
+				return
+			}
+			h.ServeHTTP(w, r)
+		})
+	})
+	repo, err := name.NewRepository(host + "/foo/bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sigs, err := name.NewRepository(host + "/foo/signatures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := pushImage(t, repo.Tag("latest"))
+	pushManifest(t, cosignTag(sigs.Digest(d.DigestStr()), "sig"), artifact(t, signatureLayer(d, nil)))
+	auth.Store(true)
+
+	out, err := handleRef(context.Background(), d, lookupOptions{
+		discovery: discoveryTag,
+		sigRepo:   &sigs,
+		keychain:  authn.NewMultiKeychain(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := manifestNamed(t, out.Groups[0], "Signatures"); m.Error != "" || len(m.Data) != 1 {
+		t.Errorf("want the signature from %s, got %d (error %q)", sigs, len(m.Data), m.Error)
+	}
+	if want := "repository:foo/signatures:pull"; !slices.Contains(scopes, want) {
+		t.Errorf("no token requested for %s, only %v", want, scopes)
+	}
+}
+
+func TestResolveSignatureRepo(t *testing.T) {
+	repo := newTestRepo(t)
+	sigs := repo.Registry.Repo("foo", "signatures")
+	d := pushImage(t, repo.Tag("latest"))
+	pushManifest(t, cosignTag(sigs.Digest(d.DigestStr()), "sig"), artifact(t, signatureLayer(d, nil)))
+
+	s := newTestServer()
+	out, code, err := resolve(t, s, d.String(), url.Values{"signatureRepo": {sigs.String()}})
+	if err != nil {
+		t.Fatalf("%d: %v", code, err)
+	}
+	if m := manifestNamed(t, out.Groups[0], "Signatures"); m.Error != "" || len(m.Data) != 1 {
+		t.Errorf("want the signature from %s, got %d (error %q)", sigs, len(m.Data), m.Error)
+	}
+
+	for _, tc := range []struct {
+		name, sigRepo string
+		want          int
+	}{
+		{"invalid", "foo/Not Valid", http.StatusBadRequest},
+		{"denied registry", "evil.example/foo/signatures", http.StatusForbidden},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestServer()
+			s.registries = &registryPolicy{deny: []string{"evil.example"}}
+			if _, code, err := resolve(t, s, d.String(), url.Values{"signatureRepo": {tc.sigRepo}}); code != tc.want {
+				t.Errorf("got %d (%v), want %d", code, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestGetManifestsMissingVersusFailed(t *testing.T) {
+	// Attestations can't be fetched, and there are no signatures at all.
+	host := newTestRegistryWith(t, func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasSuffix(r.URL.Path, ".att") {
+				http.Error(w, "boom", http.StatusInternalServerError)
+				return
+			}
+			h.ServeHTTP(w, r)
+		})
+	})
+	repo, err := name.NewRepository(host + "/foo/bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := pushImage(t, repo.Tag("latest"))
+
+	out, err := handleRef(context.Background(), d, lookupOptions{discovery: discoveryTag})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := out.Groups[0]
+	if m := manifestNamed(t, g, "Signatures"); m.Error != "" || len(m.Data) != 0 {
+		t.Errorf("signatures: want none and no error, got %d (error %q)", len(m.Data), m.Error)
+	}
+	if m := manifestNamed(t, g, "Attestations"); m.Error == "" {
+		t.Error("attestations: want an error")
+	}
+	if !strings.Contains(renderTemplate(t, out), "500 Internal Server Error") {
+		t.Error("the failure isn't shown")
+	}
+}
+
+func TestHandleRefPlatformVariant(t *testing.T) {
+	repo := newTestRepo(t)
+	idx, children := pushIndex(t, repo.Tag("latest"), "linux/arm/v6", "linux/arm/v7", "linux/arm64")
+
+	for _, tt := range []struct {
+		platform, want string
+	}{
+		{"linux/arm/v7", "linux/arm/v7"},
+		{"linux/arm/v6", "linux/arm/v6"},
+		{"linux/arm64", "linux/arm64"},
+	} {
+		p, err := v1.ParsePlatform(tt.platform)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := handleRef(context.Background(), idx, lookupOptions{discovery: discoveryTag, platform: p})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := out.ResolvedRef.Identifier(); got != children[tt.want].DigestStr() {
+			t.Errorf("%s: resolved %s, want the %s image", tt.platform, got, tt.want)
+		}
+		if out.IndexRef.Identifier() != idx.DigestStr() {
+			t.Errorf("%s: index: got %s, want %s", tt.platform, out.IndexRef, idx)
+		}
+	}
+
+	p := &v1.Platform{OS: "linux", Architecture: "arm", Variant: "v5"}
+	_, err := handleRef(context.Background(), idx, lookupOptions{discovery: discoveryTag, platform: p})
+	if !errors.Is(err, errPlatformNotFound) || !strings.Contains(err.Error(), "linux/arm/v7") {
+		t.Errorf("want the available platforms, got %v", err)
+	}
+}
+
+func TestDigestMismatch(t *testing.T) {
+	repo := newTestRepo(t)
+	d := pushImage(t, repo.Tag("latest"))
+	other := pushImage(t, repo.Tag("other"))
+	// One signature covers the image, the other was copied from another one.
+	pushManifest(t, cosignTag(d, "sig"), artifact(t, signatureLayer(d, nil), signatureLayer(other, nil)))
+
+	out, err := handleRef(context.Background(), d, lookupOptions{discovery: discoveryTag})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sigs := manifestNamed(t, out.Groups[0], "Signatures").Data
+	if len(sigs) != 2 {
+		t.Fatalf("got %d signatures, want 2", len(sigs))
+	}
+	if sigs[0].DigestMismatch || !sigs[1].DigestMismatch {
+		t.Errorf("mismatches: got %t, %t, want false, true", sigs[0].DigestMismatch, sigs[1].DigestMismatch)
+	}
+	if !strings.Contains(renderTemplate(t, out), "Does not match this image") {
+		t.Error("the mismatch isn't shown")
+	}
+}
+
+func TestDigestMismatchNotSigned(t *testing.T) {
+	repo := newTestRepo(t)
+	d := pushImage(t, repo.Tag("latest"))
+	other := pushImage(t, repo.Tag("other"))
+	// The only signature was copied from another image.
+	pushManifest(t, cosignTag(d, "sig"), artifact(t, signatureLayer(other, nil)))
+
+	out, err := handleRef(context.Background(), d, lookupOptions{discovery: discoveryTag})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Verdict.Signed {
+		t.Error("verdict: signed by a signature over another image")
+	}
+	if sum := toSummary(out, time.Now()); len(sum.Signatures) != 0 {
+		t.Errorf("summary: got %d signatures, want 0", len(sum.Signatures))
+	}
+}
+
+func TestGetManifestsReferrers(t *testing.T) {
+	repo := newTestRepo(t)
+	d := pushImage(t, repo.Tag("latest"))
+	// The same signature is stored under cosign's tag and as a referrer,
+	// alongside an attestation only found via referrers.
+	sig := signatureLayer(d, nil)
+	pushManifest(t, cosignTag(d, "sig"), artifact(t, sig))
+	pushManifest(t, repo.Tag("sig-referrer"), referrer(t, artifact(t, sig), d))
+	pushManifest(t, repo.Tag("att-referrer"), referrer(t, artifact(t, attestationLayer(t, d, "https://slsa.dev/provenance/v1", `{}`, nil)), d))
+
+	for _, tt := range []struct {
+		discovery string
+		// want is the discovery of the entries under each manifest.
+		want map[string][]string
+	}{{
+		discovery: discoveryBoth,
+		want:      map[string][]string{"Signatures": {discoveryBoth}, "Referrers": {discoveryReferrers}},
+	}, {
+		discovery: discoveryReferrers,
+		want:      map[string][]string{"Referrers": {"", ""}},
+	}, {
+		discovery: discoveryTag,
+		want:      map[string][]string{"Signatures": {""}},
+	}} {
+		t.Run(tt.discovery, func(t *testing.T) {
+			ms, _ := getManifests(context.Background(), d, lookupOptions{discovery: tt.discovery})
+			got := map[string][]string{}
+			for _, m := range ms {
+				if m.Error != "" {
+					t.Errorf("%s: %s", m.Name, m.Error)
+				}
+				for _, sd := range m.Data {
+					got[m.Name] = append(got[m.Name], sd.Discovery)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLandingPageDisabled(t *testing.T) {
+	repo := newTestRepo(t)
+	d := pushImage(t, repo.Tag("latest"))
+	s := newTestServer()
+	s.noLandingPage = true
+
+	w := httptest.NewRecorder()
+	s.handleIndex(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("landing page: got %d, want %d", w.Code, http.StatusNotFound)
+	}
+
+	// Lookups, including JSON ones negotiated on /, still work.
+	r := httptest.NewRequest(http.MethodGet, "/?image="+url.QueryEscape(d.String()), nil)
+	r.Header.Set("Accept", "application/json")
+	w = httptest.NewRecorder()
+	s.handleIndex(w, r)
+	if w.Code != http.StatusOK || !json.Valid(w.Body.Bytes()) {
+		t.Errorf("JSON lookup: got %d:\n%s", w.Code, w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	s.handleIndex(w, httptest.NewRequest(http.MethodGet, "/?image="+url.QueryEscape(d.String()), nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "<body>") {
+		t.Errorf("page lookup: got %d:\n%s", w.Code, w.Body)
+	}
+}
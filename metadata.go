@@ -0,0 +1,173 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/sigstore/fulcio/pkg/certificate"
+)
+
+// Standard OCI image labels describing where an image came from.
+const (
+	labelSource   = "org.opencontainers.image.source"
+	labelRevision = "org.opencontainers.image.revision"
+	labelCreated  = "org.opencontainers.image.created"
+)
+
+// imageMetadata is what an image's config says about where it came from.
+// Unlike provenance, labels aren't signed: anyone who can push the image can
+// set them. So they're compared against the signing certificates, which
+// can't be forged as easily.
+type imageMetadata struct {
+	Source   string `json:"source,omitempty"`
+	Revision string `json:"revision,omitempty"`
+	Created  string `json:"created,omitempty"`
+	// SignedSources and SignedRevisions are the distinct source
+	// repositories and commits named by the image's Fulcio certificates.
+	SignedSources   []string `json:"signedSources,omitempty"`
+	SignedRevisions []string `json:"signedRevisions,omitempty"`
+	// SourceMatch and RevisionMatch report whether the label is among the
+	// signed values.
+	SourceMatch   bool `json:"sourceMatch,omitempty"`
+	RevisionMatch bool `json:"revisionMatch,omitempty"`
+}
+
+// getMetadata reads the source labels from the config of image, which must
+// be an image rather than an index.
+func getMetadata(image name.Reference, opts ...remote.Option) (*imageMetadata, error) {
+	img, err := remote.Image(image, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error getting image: %w", err)
+	}
+	cf, err := img.ConfigFile()
+	if err != nil {
+		return nil, fmt.Errorf("error getting image config: %w", err)
+	}
+	labels := cf.Config.Labels
+	return &imageMetadata{
+		Source:   labels[labelSource],
+		Revision: labels[labelRevision],
+		Created:  labels[labelCreated],
+	}, nil
+}
+
+// crossCheck compares md against the source repositories and commits in the
+// certificates of out's signatures and attestations.
+func (md *imageMetadata) crossCheck(out *output) {
+	sources, revisions := map[string]bool{}, map[string]bool{}
+	for _, g := range out.Groups {
+		for _, m := range g.Data {
+			for _, s := range m.Data {
+				if s.Cert == nil {
+					continue
+				}
+				if v := sourceRepo(s.Extensions); v != "" {
+					sources[v] = true
+				}
+				if v := sourceCommit(s.Extensions); v != "" {
+					revisions[v] = true
+				}
+			}
+		}
+	}
+	md.SignedSources, md.SignedRevisions = sortedKeys(sources), sortedKeys(revisions)
+	md.SourceMatch = md.Source != "" && slices.ContainsFunc(md.SignedSources, func(s string) bool {
+		return normalizeRepoURL(s) == normalizeRepoURL(md.Source)
+	})
+	md.RevisionMatch = md.Revision != "" && slices.Contains(md.SignedRevisions, md.Revision)
+}
+
+// normalizeRepoURL drops the differences between ways of writing the same
+// repository URL, e.g. git+https://github.com/foo/bar.git.
+func normalizeRepoURL(u string) string {
+	u = strings.TrimPrefix(strings.ToLower(u), "git+")
+	u = strings.TrimSuffix(strings.TrimSuffix(u, "/"), ".git")
+	return strings.TrimPrefix(strings.TrimPrefix(u, "https://"), "http://")
+}
+
+// forgeRegistries are the registries whose namespaces are the owners of
+// repositories on a source forge, e.g. ghcr.io/foo is github.com/foo.
+var forgeRegistries = map[string]string{
+	"ghcr.io":               "github.com",
+	"docker.pkg.github.com": "github.com",
+	"registry.gitlab.com":   "gitlab.com",
+}
+
+// sourceMismatches points out where the signing certificates of out's
+// signatures and attestations name a different source than the image
+// appears to come from: its namespace on a forge's registry, or its source
+// label if metadata was fetched. This is only a heuristic, as images can be
+// legitimately mirrored or built from elsewhere, so each is worded as a
+// caution rather than a failure.
+func sourceMismatches(out *output) []string {
+	var reasons []string
+	if forge, ok := forgeRegistries[out.ResolvedRef.Context().RegistryStr()]; ok {
+		repo := out.ResolvedRef.Context()
+		namespace, _, _ := strings.Cut(repo.RepositoryStr(), "/")
+		owner := forge + "/" + strings.ToLower(namespace)
+		others := map[string]bool{}
+		for _, g := range out.Groups {
+			for _, m := range g.Data {
+				for _, s := range m.Data {
+					if s.Cert == nil {
+						continue
+					}
+					if o := sourceOwner(s.Extensions); o != "" && o != owner {
+						others[o] = true
+					}
+				}
+			}
+		}
+		for _, o := range sortedKeys(others) {
+			reasons = append(reasons, fmt.Sprintf("Signed from `%s`, but the image is published under `%s`", o, repo.RegistryStr()+"/"+namespace))
+		}
+	}
+	if md := out.Metadata; md != nil && md.Source != "" && len(md.SignedSources) > 0 && !md.SourceMatch {
+		reasons = append(reasons, fmt.Sprintf("Signed from `%s`, but the image's source label says `%s`", strings.Join(md.SignedSources, "`, `"), md.Source))
+	}
+	return reasons
+}
+
+// sourceOwner returns the owner of the repository the certificate says was
+// built, as host/owner (e.g. github.com/foo), or "" if it doesn't say.
+func sourceOwner(ext certificate.Extensions) string {
+	if ext.SourceRepositoryOwnerURI != "" {
+		return normalizeRepoURL(ext.SourceRepositoryOwnerURI)
+	}
+	repo := sourceRepo(ext)
+	if repo == "" {
+		return ""
+	}
+	parts := strings.SplitN(normalizeRepoURL(repo), "/", 3)
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[0] + "/" + parts[1]
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,106 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/x509"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/sigstore/fulcio/pkg/certificate"
+)
+
+// signedOutput is a lookup of image with a keyless signature for each of
+// exts.
+func signedOutput(t *testing.T, image string, exts ...certificate.Extensions) *output {
+	t.Helper()
+	ref, err := name.NewDigest(image + "@sha256:" + strings.Repeat("a", 64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &manifest{Name: "Signatures"}
+	for _, ext := range exts {
+		m.Data = append(m.Data, &SignatureData{Cert: &x509.Certificate{}, Extensions: ext})
+	}
+	return &output{Ref: ref, ResolvedRef: ref, Groups: []*group{{Ref: ref, Data: []*manifest{m}}}}
+}
+
+func TestSourceMismatches(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		image string
+		ext   certificate.Extensions
+		want  []string
+	}{{
+		name:  "match",
+		image: "ghcr.io/foo/bar",
+		ext:   certificate.Extensions{SourceRepositoryURI: "https://github.com/foo/bar"},
+	}, {
+		name:  "match ignoring case",
+		image: "ghcr.io/foo/bar",
+		ext:   certificate.Extensions{SourceRepositoryURI: "https://github.com/Foo/bar"},
+	}, {
+		name:  "another repository of the owner",
+		image: "ghcr.io/foo/bar",
+		ext:   certificate.Extensions{SourceRepositoryURI: "https://github.com/foo/release-tools"},
+	}, {
+		name:  "another owner",
+		image: "ghcr.io/foo/bar",
+		ext:   certificate.Extensions{SourceRepositoryURI: "https://github.com/evil/bar"},
+		want:  []string{"Signed from `github.com/evil`, but the image is published under `ghcr.io/foo`"},
+	}, {
+		name:  "owner URI",
+		image: "registry.gitlab.com/foo/bar",
+		ext:   certificate.Extensions{SourceRepositoryOwnerURI: "https://gitlab.com/evil"},
+		want:  []string{"Signed from `gitlab.com/evil`, but the image is published under `registry.gitlab.com/foo`"},
+	}, {
+		name:  "deprecated extensions",
+		image: "ghcr.io/foo/bar",
+		ext:   certificate.Extensions{GithubWorkflowRepository: "evil/bar"},
+		want:  []string{"Signed from `github.com/evil`, but the image is published under `ghcr.io/foo`"},
+	}, {
+		// Namespaces elsewhere say nothing about the source.
+		name:  "not a forge registry",
+		image: "docker.io/foo/bar",
+		ext:   certificate.Extensions{SourceRepositoryURI: "https://github.com/evil/bar"},
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sourceMismatches(signedOutput(t, tt.image, tt.ext)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSourceMismatchesLabel(t *testing.T) {
+	for _, tt := range []struct {
+		label string
+		want  int
+	}{
+		{"https://github.com/foo/bar", 0},
+		{"git+https://github.com/foo/bar.git", 0},
+		{"https://github.com/foo/other", 1},
+	} {
+		out := signedOutput(t, "registry.example.com/foo/bar", certificate.Extensions{SourceRepositoryURI: "https://github.com/foo/bar"})
+		md := &imageMetadata{Source: tt.label}
+		md.crossCheck(out)
+		out.Metadata = md
+		if got := sourceMismatches(out); len(got) != tt.want {
+			t.Errorf("label %s: got %q, want %d cautions", tt.label, got, tt.want)
+		}
+	}
+}
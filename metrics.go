@@ -0,0 +1,86 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Metrics are deliberately not labelled by image: anyone can look up
+// anything, which would make the cardinality unbounded.
+var (
+	lookupsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ocifyi_lookups_total",
+		Help: "Number of image lookups, by outcome.",
+	}, []string{"outcome"})
+
+	lookupDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "ocifyi_lookup_duration_seconds",
+		Help:    "Time taken to look up an image.",
+		Buckets: prometheus.ExponentialBuckets(0.05, 2, 12),
+	})
+
+	registryRequestsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "ocifyi_registry_requests_total",
+		Help: "Number of requests made to registries on behalf of lookups.",
+	})
+
+	lookupsInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "ocifyi_lookups_in_flight",
+		Help: "Number of lookups currently running (not counting queued ones).",
+	})
+
+	cacheLookupsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ocifyi_cache_lookups_total",
+		Help: "Number of result cache lookups, by result (hit or miss).",
+	}, []string{"result"})
+
+	panicsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "ocifyi_panics_total",
+		Help: "Number of requests that panicked.",
+	})
+)
+
+const (
+	outcomeSuccess       = "success"
+	outcomeBadRequest    = "bad_request"
+	outcomeUpstreamError = "upstream_error"
+	outcomeTimeout       = "timeout"
+)
+
+// observeLookup records the outcome of a lookup that returned the HTTP status
+// code after running for d.
+func observeLookup(code int, d time.Duration) {
+	lookupsTotal.WithLabelValues(outcomeOf(code)).Inc()
+	lookupDuration.Observe(d.Seconds())
+}
+
+// outcomeOf categorizes a lookup by the HTTP status code it returned.
+func outcomeOf(code int) string {
+	switch code {
+	case http.StatusOK, http.StatusPreconditionFailed:
+		// A digest mismatch is still a successful lookup.
+		return outcomeSuccess
+	case http.StatusBadRequest, http.StatusForbidden:
+		return outcomeBadRequest
+	case http.StatusGatewayTimeout:
+		return outcomeTimeout
+	}
+	return outcomeUpstreamError
+}
@@ -0,0 +1,202 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// Notary Project (notation) signatures are referrers of this artifact type,
+// with the signature envelope as their only layer: either JWS (JSON
+// serialization) or COSE_Sign1.
+const (
+	notationArtifactType  = "application/vnd.cncf.notary.signature"
+	notationJWSMediaType  = "application/jose+json"
+	notationCOSEMediaType = "application/cose"
+)
+
+// Header parameters the Notary Project adds to the envelope.
+const (
+	notationSigningScheme = "io.cncf.notary.signingScheme"
+	notationSigningTime   = "io.cncf.notary.signingTime"
+	notationSigningAgent  = "io.cncf.notary.signingAgent"
+)
+
+// coseHeaderX5Chain is the COSE header label of the certificate chain.
+const coseHeaderX5Chain = 33
+
+// notationSignature summarizes a Notary Project signature envelope. The
+// signing certificate and its chain go in the SignatureData itself.
+type notationSignature struct {
+	// Format is the envelope format, JWS or COSE.
+	Format string
+	// Scheme is how the signature is meant to be verified, e.g.
+	// notary.x509 against a trust store.
+	Scheme       string
+	SigningTime  time.Time
+	SigningAgent string
+}
+
+// notationPayload is what a Notary Project signature signs.
+type notationPayload struct {
+	TargetArtifact struct {
+		MediaType string `json:"mediaType"`
+		Digest    string `json:"digest"`
+	} `json:"targetArtifact"`
+}
+
+// setNotation fills in s from the Notary Project signature envelope b of the
+// given media type. The signature isn't verified: that needs a trust policy,
+// which only the consumer of the image has.
+func (s *SignatureData) setNotation(b []byte, mediaType string) error {
+	var (
+		n       *notationSignature
+		certs   [][]byte
+		payload []byte
+		err     error
+	)
+	switch mediaType {
+	case notationJWSMediaType:
+		n, certs, payload, err = parseNotationJWS(b)
+	case notationCOSEMediaType:
+		n, certs, payload, err = parseNotationCOSE(b)
+	default:
+		return fmt.Errorf("unknown signature envelope %s", mediaType)
+	}
+	if err != nil {
+		return err
+	}
+	s.Notation = n
+
+	for i, der := range certs {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return fmt.Errorf("error parsing cert: %w", err)
+		}
+		if i == 0 {
+			s.Cert = cert
+		} else {
+			s.Chain = append(s.Chain, cert)
+		}
+	}
+
+	var p notationPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return fmt.Errorf("error decoding signature payload: %w", err)
+	}
+	s.SignedDigest = p.TargetArtifact.Digest
+	return nil
+}
+
+// parseNotationJWS decodes a JWS envelope, returning its summary, its
+// certificate chain (DER, leaf first) and its payload.
+func parseNotationJWS(b []byte) (*notationSignature, [][]byte, []byte, error) {
+	var env struct {
+		Payload   string `json:"payload"`
+		Protected string `json:"protected"`
+		Header    struct {
+			X5C          [][]byte `json:"x5c"`
+			SigningAgent string   `json:"io.cncf.notary.signingAgent"`
+		} `json:"header"`
+	}
+	if err := json.Unmarshal(b, &env); err != nil {
+		return nil, nil, nil, fmt.Errorf("error decoding JWS envelope: %w", err)
+	}
+	protected, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(env.Protected, "="))
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("error decoding JWS protected header: %w", err)
+	}
+	var hdr struct {
+		SigningScheme string    `json:"io.cncf.notary.signingScheme"`
+		SigningTime   time.Time `json:"io.cncf.notary.signingTime"`
+	}
+	if err := json.Unmarshal(protected, &hdr); err != nil {
+		return nil, nil, nil, fmt.Errorf("error decoding JWS protected header: %w", err)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(env.Payload, "="))
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("error decoding JWS payload: %w", err)
+	}
+	return &notationSignature{
+		Format:       "JWS",
+		Scheme:       hdr.SigningScheme,
+		SigningTime:  hdr.SigningTime.UTC(),
+		SigningAgent: env.Header.SigningAgent,
+	}, env.Header.X5C, payload, nil
+}
+
+// coseSign1 is a COSE_Sign1 message (RFC 9052). Its CBOR tag is ignored when
+// decoding.
+type coseSign1 struct {
+	_           struct{} `cbor:",toarray"`
+	Protected   []byte
+	Unprotected map[any]any
+	Payload     []byte
+	Signature   []byte
+}
+
+// parseNotationCOSE decodes a COSE_Sign1 envelope, returning its summary, its
+// certificate chain (DER, leaf first) and its payload.
+func parseNotationCOSE(b []byte) (*notationSignature, [][]byte, []byte, error) {
+	var msg coseSign1
+	if err := cbor.Unmarshal(b, &msg); err != nil {
+		return nil, nil, nil, fmt.Errorf("error decoding COSE envelope: %w", err)
+	}
+	var protected map[any]any
+	if err := cbor.Unmarshal(msg.Protected, &protected); err != nil {
+		return nil, nil, nil, fmt.Errorf("error decoding COSE protected header: %w", err)
+	}
+
+	n := &notationSignature{Format: "COSE"}
+	n.Scheme, _ = protected[notationSigningScheme].(string)
+	switch t := protected[notationSigningTime].(type) {
+	case time.Time:
+		n.SigningTime = t.UTC()
+	case uint64:
+		n.SigningTime = time.Unix(int64(t), 0).UTC()
+	}
+	n.SigningAgent, _ = msg.Unprotected[notationSigningAgent].(string)
+
+	// The chain is a single certificate or an array of them.
+	var certs [][]byte
+	for k, v := range msg.Unprotected {
+		if label, ok := k.(uint64); !ok || label != coseHeaderX5Chain {
+			continue
+		}
+		switch v := v.(type) {
+		case []byte:
+			certs = append(certs, v)
+		case []any:
+			for _, c := range v {
+				der, ok := c.([]byte)
+				if !ok {
+					return nil, nil, nil, errors.New("invalid COSE certificate chain")
+				}
+				certs = append(certs, der)
+			}
+		default:
+			return nil, nil, nil, errors.New("invalid COSE certificate chain")
+		}
+	}
+	return n, certs, msg.Payload, nil
+}
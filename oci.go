@@ -16,105 +16,491 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/base64"
 	"encoding/json"
 	"encoding/pem"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
 
 	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/google/go-containerregistry/pkg/v1/types"
 	"github.com/in-toto/in-toto-golang/in_toto"
 	"github.com/secure-systems-lab/go-securesystemslib/dsse"
 	"github.com/sigstore/cosign/v2/pkg/cosign/bundle"
 	ociremote "github.com/sigstore/cosign/v2/pkg/oci/remote"
+	ctypes "github.com/sigstore/cosign/v2/pkg/types"
 	"github.com/sigstore/fulcio/pkg/certificate"
+	"github.com/sigstore/rekor/pkg/generated/models"
+	"github.com/sigstore/sigstore/pkg/signature/payload"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/exp/slog"
 )
 
 type SignatureData struct {
-	Bundle        *bundle.RekorBundle
-	Cert          *x509.Certificate
+	Bundle *bundle.RekorBundle
+	Cert   *x509.Certificate
+	// Chain is the certificates Cert chains to, leaf-most first, if the
+	// signature carried them.
+	Chain         []*x509.Certificate
 	Extensions    certificate.Extensions
 	Layer         name.Reference
 	LayerType     string
 	PredicateType string
+	// Subjects are the artifacts an in-toto statement is about.
+	Subjects []in_toto.Subject
+	Envelope *dsse.Envelope
+	// Provenance summarizes SLSA provenance attestations.
+	Provenance *provenanceSummary
+	// Scan summarizes vulnerability scan attestations.
+	Scan *scanSummary
+	// SBOM summarizes CycloneDX and SPDX SBOMs, whether attested or
+	// attached as is.
+	SBOM *sbomSummary
+	// Tekton summarizes Tekton Chains provenance.
+	Tekton *tektonSummary
+	// Notation summarizes Notary Project signatures.
+	Notation *notationSignature
+	// MessageSignature is the signature of a sigstore bundle that signs the
+	// artifact directly rather than a DSSE envelope.
+	MessageSignature *messageSignature
+	// Discovery is how the signature was found (discoveryTag,
+	// discoveryReferrers or discoveryBoth), if both methods were tried.
+	Discovery string
+	// Verification is the result of verifying the signature, if requested.
+	Verification *verification
+	// SCT is the result of verifying the certificate's embedded signed
+	// certificate timestamp, i.e. that it was logged to the CT log, if
+	// verification was requested.
+	SCT *verification
+	// InclusionProof proves Bundle's Rekor entry is in the log, for
+	// signatures whose bundle carries one (sigstore bundles).
+	InclusionProof *models.InclusionProof
+	// Tlog is the result of checking Bundle's Rekor entry offline against
+	// the Rekor keys of the trust root: its signed entry timestamp, and its
+	// inclusion proof if it has one. Only set if verification was
+	// requested.
+	Tlog *verification
+	// DetachedSignature is the blob holding the signature, for layouts that
+	// store it separately rather than inline in the layer's annotations.
+	DetachedSignature *name.Digest
+	// SignedDigest is the image digest a simple signing payload claims to
+	// cover.
+	SignedDigest string
+	// DigestMismatch is set if SignedDigest isn't the digest of the image
+	// the signature is attached to.
+	DigestMismatch bool
 }
 
-func getSignature(ref name.Reference, opts ...remote.Option) (name.Digest, []*SignatureData, error) {
-	sigRef, err := ociremote.SignatureTag(ref, ociremote.WithRemoteOptions(opts...))
+// getSignature returns the signatures attached via cosign's .sig tag. ro
+// configures where cosign's tags live (e.g. COSIGN_REPOSITORY). An unsigned
+// image is not an error.
+func getSignature(ctx context.Context, ref name.Reference, ro []ociremote.Option, opts ...remote.Option) (*manifest, error) {
+	sigRef, err := ociremote.SignatureTag(ref, append(ro, ociremote.WithRemoteOptions(opts...))...)
 	if err != nil {
-		return name.Digest{}, nil, fmt.Errorf("error getting signature tag: %v", err)
+		return &manifest{}, fmt.Errorf("error getting signature tag: %v", err)
 	}
 
-	return getData(sigRef, opts...)
+	m, err := getData(ctx, sigRef, opts...)
+	if isNotFound(err) {
+		return &manifest{}, nil
+	}
+	return m, err
+}
+
+// getSBOM returns the SBOMs attached via cosign's .sbom tag. Most images don't
+// have one, so a missing tag is not an error.
+func getSBOM(ctx context.Context, ref name.Reference, ro []ociremote.Option, opts ...remote.Option) (*manifest, error) {
+	sbomRef, err := ociremote.SBOMTag(ref, append(ro, ociremote.WithRemoteOptions(opts...))...)
+	if err != nil {
+		return &manifest{}, fmt.Errorf("error getting sbom tag: %v", err)
+	}
+
+	m, err := getData(ctx, sbomRef, opts...)
+	if isNotFound(err) {
+		return &manifest{}, nil
+	}
+	return m, err
+}
+
+// isNotFound reports whether err is a registry 404.
+func isNotFound(err error) bool {
+	var terr *transport.Error
+	return errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound
+}
+
+// getReferrers returns the manifests that refer to digest via the OCI 1.1
+// referrers API (or its fallback tag scheme on registries without it).
+func getReferrers(ctx context.Context, digest name.Digest, opts ...remote.Option) ([]*manifest, []byte, error) {
+	idx, err := remote.Referrers(digest, opts...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error getting referrers: %w", err)
+	}
+	raw, err := idx.RawManifest()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error getting referrers index: %w", err)
+	}
+	im, err := idx.IndexManifest()
+	if err != nil {
+		return nil, raw, fmt.Errorf("error getting referrers index: %w", err)
+	}
+
+	out := make([]*manifest, 0, len(im.Manifests))
+	for _, d := range im.Manifests {
+		m, err := getData(ctx, digest.Context().Digest(d.Digest.String()), opts...)
+		if err != nil {
+			return out, raw, err
+		}
+		m.Name = "Referrers"
+		// Some registries derive the descriptor's artifactType from the
+		// config media type, reporting the empty config for OCI 1.1
+		// artifacts, so prefer what the manifest itself says.
+		if m.ArtifactType == "" && d.ArtifactType != mediaTypeEmpty {
+			m.ArtifactType = d.ArtifactType
+		}
+		if m.ArtifactType == notationArtifactType {
+			m.Name = "Notation"
+		}
+		out = append(out, m)
+	}
+	return out, raw, nil
+}
+
+// getChildren returns the index manifest at ref, along with the descriptors of
+// its children.
+func getChildren(ref name.Digest, opts ...remote.Option) (*v1.IndexManifest, []v1.Descriptor, error) {
+	idx, err := remote.Index(ref, opts...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error getting remote index: %w", err)
+	}
+	im, err := idx.IndexManifest()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error getting index manifest: %w", err)
+	}
+	return im, im.Manifests, nil
+}
+
+// hasPlatform reports whether the index child d is a platform-specific image.
+// Attestation manifests and other artifacts have no platform, or buildkit's
+// "unknown/unknown".
+func hasPlatform(d v1.Descriptor) bool {
+	return d.Platform != nil && d.Platform.OS != "unknown"
+}
+
+// childLabel names the index child d: its platform, or for children without
+// one, its artifactType or failing that its digest.
+func childLabel(d v1.Descriptor) string {
+	switch {
+	case hasPlatform(d):
+		return d.Platform.String()
+	case d.ArtifactType != "":
+		return d.ArtifactType
+	}
+	return d.Digest.String()
 }
 
-func getData(ref name.Reference, opts ...remote.Option) (name.Digest, []*SignatureData, error) {
-	img, err := remote.Image(ref, opts...)
+var errPlatformNotFound = errors.New("index has no such platform")
+
+// pinPlatform resolves the child of index matching platform.
+func pinPlatform(index name.Digest, platform v1.Platform, opts ...remote.Option) (name.Digest, error) {
+	img, err := remote.Image(index, append(opts, remote.WithPlatform(platform))...)
 	if err != nil {
-		return name.Digest{}, nil, fmt.Errorf("error getting remote image: %w", err)
+		// If that's because there's no such platform, say which there are.
+		if _, children, cerr := getChildren(index, opts...); cerr == nil && !slices.ContainsFunc(children, func(c v1.Descriptor) bool {
+			return hasPlatform(c) && c.Platform.Satisfies(platform)
+		}) {
+			available := make([]string, 0, len(children))
+			for _, c := range children {
+				if hasPlatform(c) {
+					available = append(available, c.Platform.String())
+				}
+			}
+			return name.Digest{}, fmt.Errorf("%w %s, available platforms: %s", errPlatformNotFound, platform, strings.Join(available, ", "))
+		}
+		return name.Digest{}, fmt.Errorf("error resolving platform %s: %w", platform, err)
 	}
 	d, err := img.Digest()
 	if err != nil {
-		return name.Digest{}, nil, fmt.Errorf("error getting digest: %v", err)
+		return name.Digest{}, fmt.Errorf("error getting platform image digest: %w", err)
 	}
-	digest := ref.Context().Digest(d.String())
-	manifest, err := img.Manifest()
+	return index.Context().Digest(d.String()), nil
+}
+
+// getData fetches the manifest at ref and parses the signing data out of each
+// layer. On error, the returned manifest contains whatever was resolved before
+// the failure.
+func getData(ctx context.Context, ref name.Reference, opts ...remote.Option) (*manifest, error) {
+	ctx, span := tracer.Start(ctx, "getData", trace.WithAttributes(attribute.String("ref", ref.String())))
+	defer span.End()
+	opts = append(slices.Clip(opts), remote.WithContext(ctx))
+
+	desc, err := remote.Get(ref, opts...)
 	if err != nil {
-		return digest, nil, fmt.Errorf("error getting manifest: %w", err)
+		span.RecordError(err)
+		return &manifest{}, fmt.Errorf("error getting remote image: %w", err)
+	}
+	span.SetAttributes(attribute.String("digest", desc.Digest.String()))
+	m := &manifest{
+		Digest:    ref.Context().Digest(desc.Digest.String()).String(),
+		MediaType: string(desc.MediaType),
+		Manifest:  desc.Manifest,
 	}
 
-	var out []*SignatureData
-	for _, l := range manifest.Layers {
+	// Some tools store signatures as an index of signature images, so
+	// flatten the children's layers into this manifest. Nested indexes aren't
+	// followed.
+	if desc.MediaType.IsIndex() {
+		im, err := v1.ParseIndexManifest(bytes.NewReader(desc.Manifest))
+		if err != nil {
+			return m, fmt.Errorf("error parsing index manifest: %w", err)
+		}
+		for _, d := range im.Manifests {
+			if d.MediaType.IsIndex() {
+				continue
+			}
+			child, err := getData(ctx, ref.Context().Digest(d.Digest.String()), opts...)
+			m.Data = append(m.Data, child.Data...)
+			if err != nil {
+				return m, err
+			}
+		}
+		return m, nil
+	}
+
+	// Registries may hand back media types we don't know about (new artifact
+	// types, misconfigured static registries, etc.) - rather than give up,
+	// assume the manifest is image-shaped and see how far we get.
+	mf, err := v1.ParseManifest(bytes.NewReader(desc.Manifest))
+	if err != nil {
+		return m, fmt.Errorf("error parsing manifest (%s): %w", desc.MediaType, err)
+	}
+	m.ArtifactType = artifactType(desc.Manifest, mf)
+
+	for _, l := range mf.Layers {
 		s := new(SignatureData)
+		var inline bool
 		for k, v := range l.Annotations {
 			switch k {
+			case signatureAnnotation:
+				inline = v != ""
+			case detachedSignatureAnnotation:
+				h, err := v1.NewHash(v)
+				if err != nil {
+					return m, fmt.Errorf("error parsing detached signature digest: %w", err)
+				}
+				d := ref.Context().Digest(h.String())
+				s.DetachedSignature = &d
 			case "dev.sigstore.cosign/bundle":
 				bundle := new(bundle.RekorBundle)
 				if err := json.Unmarshal([]byte(v), bundle); err != nil {
-					return digest, nil, fmt.Errorf("error unmarshalling bundle: %w", err)
+					return m, fmt.Errorf("error unmarshalling bundle: %w", err)
 				}
 				s.Bundle = bundle
 
 			case "dev.sigstore.cosign/certificate":
-				data, _ := pem.Decode([]byte(v))
-				cert, err := x509.ParseCertificate(data.Bytes)
+				certs, err := parseCerts(v)
 				if err != nil {
-					return digest, nil, fmt.Errorf("error parsing cert: %w", err)
+					return m, fmt.Errorf("error parsing cert: %w", err)
 				}
+				cert := certs[0]
 				s.Cert = cert
+				// Some signers bundle the chain in with the leaf rather
+				// than using the chain annotation.
+				if len(certs) > 1 {
+					s.Chain = certs[1:]
+				}
 				ext, err := parseExtensions(cert.Extensions)
 				if err != nil {
-					return digest, nil, fmt.Errorf("error parsing extensions: %w", err)
+					return m, fmt.Errorf("error parsing extensions: %w", err)
 				}
 
 				s.Extensions = ext
+			case "dev.sigstore.cosign/chain":
+				chain, err := parseCerts(v)
+				if err != nil {
+					return m, fmt.Errorf("error parsing cert chain: %w", err)
+				}
+				if s.Chain == nil {
+					s.Chain = chain
+				}
 			case "predicateType":
-				s.LayerType = v
+				s.PredicateType = v
 			}
 		}
+		// cosign itself only ever looks at the inline signature.
+		if inline {
+			s.DetachedSignature = nil
+		}
 		s.LayerType = string(l.MediaType)
 		layerDigest := ref.Context().Digest(l.Digest.String())
 		s.Layer = layerDigest
 
+		if l.MediaType == ctypes.SimpleSigningMediaType {
+			if s.SignedDigest, err = readSignedDigest(layerDigest, opts...); err != nil {
+				return m, fmt.Errorf("error reading signed payload: %w", err)
+			}
+		}
+
 		// If it's a DSSE envelope, we might be able to extract more useful info from the predicate.
 		if l.MediaType == "application/vnd.dsse.envelope.v1+json" {
-			intoto, err := readIntotoHeader(layerDigest)
+			env, err := readEnvelope(ctx, layerDigest, opts...)
+			if err != nil {
+				return m, fmt.Errorf("error reading dsse envelope: %w", err)
+			}
+			if err := s.setEnvelope(env); err != nil {
+				return m, err
+			}
+		}
+
+		// Newer cosign versions put everything in a sigstore bundle rather
+		// than the annotations.
+		if isSigstoreBundle(string(l.MediaType)) {
+			b, err := readLayer(layerDigest, opts...)
+			if err != nil {
+				return m, fmt.Errorf("error reading sigstore bundle: %w", err)
+			}
+			if err := s.setSigstoreBundle(b); err != nil {
+				return m, fmt.Errorf("error parsing sigstore bundle: %w", err)
+			}
+		}
+
+		// SBOMs attached as is (e.g. by `cosign attach sbom`). Only the JSON
+		// formats are summarized.
+		if f := sbomFormat(string(l.MediaType)); (f == "SPDX" || f == "CycloneDX") && strings.Contains(string(l.MediaType), "json") {
+			if b, err := readLayer(layerDigest, opts...); err != nil {
+				slog.Warn("failed to read sbom", "layer", layerDigest.String(), "error", err)
+			} else if s.SBOM, err = parseSBOM(b); err != nil {
+				slog.Warn("failed to parse sbom", "layer", layerDigest.String(), "error", err)
+			}
+		}
+
+		if m.ArtifactType == notationArtifactType {
+			b, err := readLayer(layerDigest, opts...)
 			if err != nil {
-				return digest, nil, fmt.Errorf("error reading intoto header: %w", err)
+				return m, fmt.Errorf("error reading notation signature: %w", err)
 			}
-			if intoto != nil {
-				s.PredicateType = intoto.PredicateType
+			if err := s.setNotation(b, string(l.MediaType)); err != nil {
+				return m, fmt.Errorf("error parsing notation signature: %w", err)
 			}
 		}
 
-		out = append(out, s)
+		m.Data = append(m.Data, s)
+	}
+	return m, nil
+}
+
+// setEnvelope records the DSSE envelope env on s, along with whatever can be
+// summarized from the in-toto statement it carries.
+func (s *SignatureData) setEnvelope(env *dsse.Envelope) error {
+	s.Envelope = env
+	intoto, payload, err := decodeStatement(env)
+	if err != nil {
+		return fmt.Errorf("error reading intoto header: %w", err)
+	}
+	if intoto == nil {
+		return nil
+	}
+	// Prefer the predicate type from the signed statement over the
+	// (unsigned) layer annotation.
+	s.PredicateType = intoto.PredicateType
+	s.Subjects = intoto.Subject
+	if s.Provenance, err = parseProvenance(intoto.PredicateType, payload); err != nil {
+		slog.Warn("failed to parse provenance", "layer", s.Layer.String(), "error", err)
+	}
+	if s.Tekton, err = parseTektonChains(payload); err != nil {
+		slog.Warn("failed to parse tekton chains provenance", "layer", s.Layer.String(), "error", err)
+	}
+	// Not being able to summarize a predicate shouldn't hide the
+	// attestation - it can still be viewed raw.
+	if isScanResult(intoto.PredicateType) {
+		if s.Scan, err = parseScanResult(payload); err != nil {
+			slog.Warn("failed to parse scan result", "layer", s.Layer.String(), "error", err)
+		}
+	}
+	if isSBOMPredicate(intoto.PredicateType) {
+		if s.SBOM, err = parseSBOMStatement(payload); err != nil {
+			slog.Warn("failed to parse sbom", "layer", s.Layer.String(), "error", err)
+		}
+	}
+	return nil
+}
+
+// mediaTypeEmpty is the OCI 1.1 empty JSON descriptor, used as the config of
+// artifacts that don't need one.
+const mediaTypeEmpty = "application/vnd.oci.empty.v1+json"
+
+// artifactType returns the artifact type of the manifest raw (parsed as mf),
+// or "" for a plain image. OCI 1.1 artifacts set artifactType, typically
+// alongside the empty config. Before that, the config media type was used
+// to say what an artifact was.
+func artifactType(raw []byte, mf *v1.Manifest) string {
+	var a struct {
+		ArtifactType string `json:"artifactType"`
+	}
+	if err := json.Unmarshal(raw, &a); err == nil && a.ArtifactType != "" {
+		return a.ArtifactType
+	}
+	switch mf.Config.MediaType {
+	case "", mediaTypeEmpty, types.OCIConfigJSON, types.DockerConfigJSON:
+		return ""
+	}
+	return string(mf.Config.MediaType)
+}
+
+// Signature layers usually carry their (base64) signature inline in the
+// signatureAnnotation. Some layouts instead store it as a separate blob in the
+// same repository, pointing at it by digest with detachedSignatureAnnotation.
+const (
+	signatureAnnotation         = "dev.cosignproject.cosign/signature"
+	detachedSignatureAnnotation = "dev.cosignproject.cosign/signature-digest"
+)
+
+// maxLayerSize bounds how much of a signature or attestation layer we're
+// willing to read into memory.
+const maxLayerSize = 4 << 20
+
+// readEnvelope fetches the DSSE envelope stored in the given layer.
+func readEnvelope(ctx context.Context, digest name.Digest, opts ...remote.Option) (*dsse.Envelope, error) {
+	ctx, span := tracer.Start(ctx, "readEnvelope", trace.WithAttributes(attribute.String("digest", digest.String())))
+	defer span.End()
+
+	b, err := readLayer(digest, append(slices.Clip(opts), remote.WithContext(ctx))...)
+	if err != nil {
+		return nil, err
+	}
+	env := new(dsse.Envelope)
+	if err := json.Unmarshal(b, env); err != nil {
+		return nil, fmt.Errorf("error decoding dsse envelope: %w", err)
+	}
+	return env, nil
+}
+
+// readSignedDigest returns the image digest claimed by the simple signing
+// payload at digest.
+func readSignedDigest(digest name.Digest, opts ...remote.Option) (string, error) {
+	b, err := readLayer(digest, opts...)
+	if err != nil {
+		return "", err
+	}
+	p := new(payload.SimpleContainerImage)
+	if err := json.Unmarshal(b, p); err != nil {
+		return "", fmt.Errorf("error decoding simple signing payload: %w", err)
 	}
-	return digest, out, nil
+	return p.Critical.Image.DockerManifestDigest, nil
 }
 
-func readIntotoHeader(digest name.Digest, opts ...remote.Option) (*in_toto.StatementHeader, error) {
+// readLayer returns the contents of the (small) layer at digest.
+func readLayer(digest name.Digest, opts ...remote.Option) ([]byte, error) {
 	blob, err := remote.Layer(digest, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("error getting layer: %w", err)
@@ -125,30 +511,69 @@ func readIntotoHeader(digest name.Digest, opts ...remote.Option) (*in_toto.State
 	}
 	defer r.Close()
 
-	env := new(dsse.Envelope)
-	if err := json.NewDecoder(r).Decode(env); err != nil {
-		return nil, fmt.Errorf("error decoding dsse envelope: %w", err)
+	b, err := io.ReadAll(io.LimitReader(r, maxLayerSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("error reading layer content: %w", err)
+	}
+	if len(b) > maxLayerSize {
+		return nil, fmt.Errorf("layer exceeds %d bytes", maxLayerSize)
 	}
+	return b, nil
+}
+
+// decodeStatement decodes the in-toto statement carried by env, returning both
+// the statement header and the raw statement JSON. If env does not carry an
+// in-toto payload, a nil header is returned.
+func decodeStatement(env *dsse.Envelope) (*in_toto.StatementHeader, []byte, error) {
 	if env.PayloadType != "application/vnd.in-toto+json" {
-		return nil, nil
+		return nil, nil, nil
 	}
 
+	payload, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, bytes.NewBufferString(env.Payload)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("error decoding dsse payload: %w", err)
+	}
 	out := new(in_toto.StatementHeader)
-	if err := json.NewDecoder(base64.NewDecoder(base64.StdEncoding, bytes.NewBufferString(env.Payload))).Decode(out); err != nil {
-		return nil, fmt.Errorf("error decoding intoto statement: %w", err)
+	if err := json.Unmarshal(payload, out); err != nil {
+		return nil, nil, fmt.Errorf("error decoding intoto statement: %w", err)
 	}
-	return out, nil
+	return out, payload, nil
+}
+
+// parseCerts decodes every PEM certificate in s, in order.
+func parseCerts(s string) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	rest := []byte(s)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no PEM certificates found")
+	}
+	return certs, nil
 }
 
 // forked from fulcio since it's not exported.
 func parseExtensions(ext []pkix.Extension) (certificate.Extensions, error) {
 	out := certificate.Extensions{}
+	// Certs issued during the OID migration can carry both issuer
+	// extensions. The V2 value wins regardless of extension order.
+	var deprecatedIssuer string
 
 	for _, e := range ext {
 		switch {
 		// BEGIN: Deprecated
 		case e.Id.Equal(certificate.OIDIssuer):
-			out.Issuer = string(e.Value)
+			deprecatedIssuer = string(e.Value)
 		case e.Id.Equal(certificate.OIDGitHubWorkflowTrigger):
 			out.GithubWorkflowTrigger = string(e.Value)
 		case e.Id.Equal(certificate.OIDGitHubWorkflowSHA):
@@ -223,6 +648,10 @@ func parseExtensions(ext []pkix.Extension) (certificate.Extensions, error) {
 		}
 	}
 
+	if out.Issuer == "" {
+		out.Issuer = deprecatedIssuer
+	}
+
 	// We only ever return nil, but leaving error in place so that we can add
 	// more complex parsing of fields in a backwards compatible way if needed.
 	return out, nil
@@ -0,0 +1,296 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/sigstore/fulcio/pkg/certificate"
+)
+
+// issuerV2 is a V2 issuer extension, which unlike the deprecated one is a DER
+// encoded string.
+func issuerV2(t *testing.T, issuer string) pkix.Extension {
+	t.Helper()
+	v, err := asn1.MarshalWithParams(issuer, "utf8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pkix.Extension{Id: certificate.OIDIssuerV2, Value: v}
+}
+
+func issuerV1(issuer string) pkix.Extension {
+	return pkix.Extension{Id: certificate.OIDIssuer, Value: []byte(issuer)}
+}
+
+func TestParseExtensions(t *testing.T) {
+	const (
+		old = "https://old.example.com"
+		cur = "https://token.actions.githubusercontent.com"
+	)
+	for _, tt := range []struct {
+		name string
+		ext  []pkix.Extension
+		want string
+	}{{
+		name: "none",
+	}, {
+		name: "deprecated only",
+		ext:  []pkix.Extension{issuerV1(old)},
+		want: old,
+	}, {
+		name: "v2 only",
+		ext:  []pkix.Extension{issuerV2(t, cur)},
+		want: cur,
+	}, {
+		name: "deprecated first",
+		ext:  []pkix.Extension{issuerV1(old), issuerV2(t, cur)},
+		want: cur,
+	}, {
+		name: "v2 first",
+		ext:  []pkix.Extension{issuerV2(t, cur), issuerV1(old)},
+		want: cur,
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			// Round trip through a certificate, as the extensions would arrive.
+			cert, _ := newTestCert(t, &x509.Certificate{ExtraExtensions: tt.ext})
+			got, err := parseExtensions(cert.Extensions)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Issuer != tt.want {
+				t.Errorf("issuer: got %q, want %q", got.Issuer, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseExtensionsV2Fields(t *testing.T) {
+	want := certificate.Extensions{
+		Issuer:                 "https://token.actions.githubusercontent.com",
+		SourceRepositoryURI:    "https://github.com/foo/bar",
+		SourceRepositoryDigest: "abc123",
+		BuildConfigURI:         "https://github.com/foo/bar/.github/workflows/release.yaml@refs/heads/main",
+		RunInvocationURI:       "https://github.com/foo/bar/actions/runs/1/attempts/1",
+		RunnerEnvironment:      "github-hosted",
+	}
+	ext, err := want.Render()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := newTestCert(t, &x509.Certificate{ExtraExtensions: ext})
+	got, err := parseExtensions(cert.Extensions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestParseExtensionsMalformed(t *testing.T) {
+	// V2 values must be DER strings, unlike the deprecated raw ones.
+	ext := []pkix.Extension{{Id: certificate.OIDIssuerV2, Value: []byte("https://old.example.com")}}
+	if _, err := parseExtensions(ext); err == nil {
+		t.Error("want an error for a raw V2 issuer")
+	}
+}
+
+func TestGetDataPredicateType(t *testing.T) {
+	repo := newTestRepo(t)
+	d := pushImage(t, repo.Tag("latest"))
+	const mt = "application/vnd.in-toto+json"
+	layer := mutate.Addendum{
+		Layer:       static.NewLayer([]byte(`{}`), mt),
+		Annotations: map[string]string{"predicateType": "https://slsa.dev/provenance/v1"},
+	}
+	// A DSSE envelope's own statement decides its predicate type.
+	att := attestationLayer(t, d, "https://spdx.dev/Document", `{}`, map[string]string{"predicateType": "https://cyclonedx.org/bom"})
+	tag := cosignTag(d, "att")
+	pushManifest(t, tag, artifact(t, layer, att))
+
+	m, err := getData(context.Background(), tag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Data) != 2 {
+		t.Fatalf("got %d layers, want 2", len(m.Data))
+	}
+	for i, want := range []struct{ layerType, predicateType string }{
+		{mt, "https://slsa.dev/provenance/v1"},
+		{"application/vnd.dsse.envelope.v1+json", "https://spdx.dev/Document"},
+	} {
+		if got := m.Data[i]; got.LayerType != want.layerType || got.PredicateType != want.predicateType {
+			t.Errorf("layer %d: got (%q, %q), want (%q, %q)", i, got.LayerType, got.PredicateType, want.layerType, want.predicateType)
+		}
+	}
+}
+
+func TestGetDataUnknownMediaType(t *testing.T) {
+	repo := newTestRepo(t)
+	d := pushImage(t, repo.Tag("latest"))
+	const mt = "application/vnd.example.signatures.v1+json"
+	tag := cosignTag(d, "sig")
+	pushManifest(t, tag, mutate.MediaType(artifact(t, signatureLayer(d, nil)), mt))
+
+	m, err := getData(context.Background(), tag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.MediaType != mt {
+		t.Errorf("media type: got %q, want %q", m.MediaType, mt)
+	}
+	// It's image-shaped, so the signature is still found.
+	if len(m.Data) != 1 || m.Data[0].SignedDigest != d.DigestStr() {
+		t.Errorf("want the signature of %s, got %+v", d.DigestStr(), m.Data)
+	}
+}
+
+func TestReadLayerTooLarge(t *testing.T) {
+	repo := newTestRepo(t)
+	d := pushImage(t, repo.Tag("latest"))
+	// Attestations are read whole, so huge ones are turned away.
+	att := mutate.Addendum{Layer: static.NewLayer(make([]byte, maxLayerSize+1), "application/vnd.dsse.envelope.v1+json")}
+	tag := cosignTag(d, "att")
+	pushManifest(t, tag, artifact(t, att))
+
+	if _, err := getData(context.Background(), tag); err == nil || !strings.Contains(err.Error(), "exceeds") {
+		t.Errorf("want an error for an oversized layer, got %v", err)
+	}
+}
+
+func TestGetDataSignatureIndex(t *testing.T) {
+	repo := newTestRepo(t)
+	d := pushImage(t, repo.Tag("latest"))
+	// Some tools push one signature image per signer under an index.
+	idx := mutate.AppendManifests(empty.Index,
+		mutate.IndexAddendum{Add: artifact(t, signatureLayer(d, nil))},
+		mutate.IndexAddendum{Add: artifact(t, signatureLayer(d, map[string]string{"dev.sigstore.cosign/bundle": rekorBundle(1, time.Now())}))},
+	)
+	tag := cosignTag(d, "sig")
+	pushManifest(t, tag, idx)
+
+	m, err := getData(context.Background(), tag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Data) != 2 {
+		t.Fatalf("got %d signatures, want both children's", len(m.Data))
+	}
+	for _, sd := range m.Data {
+		if sd.SignedDigest != d.DigestStr() {
+			t.Errorf("signed digest: got %q, want %q", sd.SignedDigest, d.DigestStr())
+		}
+	}
+}
+
+func TestGetDataChain(t *testing.T) {
+	repo := newTestRepo(t)
+	d := pushImage(t, repo.Tag("latest"))
+	root := newTestCA(t, nil)
+	intermediate := newTestCA(t, root)
+	leaf, _ := intermediate.issue(t, &x509.Certificate{EmailAddresses: []string{"me@example.com"}})
+	chain := certPEM(intermediate.cert) + certPEM(root.cert)
+
+	tag := cosignTag(d, "sig")
+	pushManifest(t, tag, artifact(t,
+		signatureLayer(d, map[string]string{
+			"dev.sigstore.cosign/certificate": certPEM(leaf),
+			"dev.sigstore.cosign/chain":       chain,
+		}),
+		// Some signers put the chain in with the leaf instead.
+		signatureLayer(d, map[string]string{
+			"dev.sigstore.cosign/certificate": certPEM(leaf) + chain,
+		}),
+	))
+
+	m, err := getData(context.Background(), tag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, s := range m.Data {
+		if !s.Cert.Equal(leaf) {
+			t.Errorf("layer %d: wrong leaf certificate", i)
+		}
+		if len(s.Chain) != 2 || !s.Chain[0].Equal(intermediate.cert) || !s.Chain[1].Equal(root.cert) {
+			t.Errorf("layer %d: got a chain of %d, want the intermediate then the root", i, len(s.Chain))
+		}
+	}
+	if got, want := certChain(m.Data[0].Cert, m.Data[0].Chain), "sigstore-intermediate → sigstore (root)"; got != want {
+		t.Errorf("certChain: got %q, want %q", got, want)
+	}
+}
+
+func TestParseCerts(t *testing.T) {
+	_, leaf := newTestCert(t, &x509.Certificate{})
+	_, other := newTestCert(t, &x509.Certificate{})
+	for _, tc := range []struct {
+		name    string
+		in      string
+		want    int
+		wantErr string
+	}{
+		{name: "one", in: leaf, want: 1},
+		{name: "chain", in: leaf + other, want: 2},
+		{name: "not PEM", in: "not pem", wantErr: "no PEM certificates found"},
+		{name: "empty", in: "", wantErr: "no PEM certificates found"},
+		{name: "bad DER", in: "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n", wantErr: "x509"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			certs, err := parseCerts(tc.in)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("got %v, want an error containing %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(certs) != tc.want {
+				t.Errorf("got %d certificates, want %d", len(certs), tc.want)
+			}
+		})
+	}
+}
+
+func TestGetDataMalformedCert(t *testing.T) {
+	repo := newTestRepo(t)
+	d := pushImage(t, repo.Tag("latest"))
+	for _, tc := range []struct {
+		annotation, want string
+	}{
+		{"dev.sigstore.cosign/certificate", "error parsing cert: no PEM certificates found"},
+		{"dev.sigstore.cosign/chain", "error parsing cert chain: no PEM certificates found"},
+	} {
+		t.Run(tc.annotation, func(t *testing.T) {
+			tag := cosignTag(d, "sig")
+			pushManifest(t, tag, artifact(t, signatureLayer(d, map[string]string{tc.annotation: "not pem"})))
+			_, err := getData(context.Background(), tag)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("got %v, want %q", err, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// page is the window of each manifest's entries that's shown. An attestation
+// tag can hold dozens of layers, which makes for a huge, slow page.
+//
+// Only what's shown is paged: the verdict, trust summary, signer tables and
+// policy checks still consider every entry.
+type page struct {
+	Offset int
+	Limit  int
+	// Prev and Next link to the neighbouring pages, if there are any.
+	Prev string
+	Next string
+}
+
+// newPage pages through the entries of out's manifests, limit at a time from
+// offset, linking to the other pages with u's query.
+func newPage(out *output, u *url.URL, offset, limit int) *page {
+	p := &page{Offset: offset, Limit: limit}
+	link := func(offset int) string {
+		q := u.Query()
+		q.Del("offset")
+		if offset > 0 {
+			q.Set("offset", strconv.Itoa(offset))
+		}
+		return u.Path + "?" + q.Encode()
+	}
+	if offset > 0 {
+		p.Prev = link(max(offset-limit, 0))
+	}
+	for _, g := range out.Groups {
+		for _, m := range g.Data {
+			if len(m.Data) > offset+limit {
+				p.Next = link(offset + limit)
+			}
+		}
+	}
+	return p
+}
+
+// pageOf returns the entries of data on p, or all of them without a page.
+func pageOf(p *page, data []*SignatureData) []*SignatureData {
+	if p == nil {
+		return data
+	}
+	if p.Offset >= len(data) {
+		return nil
+	}
+	return data[p.Offset:min(p.Offset+p.Limit, len(data))]
+}
+
+// Showing describes which of total entries are on p, e.g. "11–20 of 45", or
+// returns "" if that's all of them.
+func (p *page) Showing(total int) string {
+	switch {
+	case p.Offset == 0 && total <= p.Limit:
+		return ""
+	case p.Offset >= total:
+		return fmt.Sprintf("none of %d", total)
+	}
+	return fmt.Sprintf("%d–%d of %d", p.Offset+1, min(p.Offset+p.Limit, total), total)
+}
@@ -0,0 +1,59 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"runtime/debug"
+
+	"golang.org/x/exp/slog"
+)
+
+// recoverPanics turns a panic in h into a 500, rather than net/http's
+// default of dropping the connection. Registry data is attacker-controlled,
+// so a malformed signature shouldn't be able to take out a request with a
+// stack trace; the stack is logged instead.
+func (s *server) recoverPanics(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w}
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			// net/http's way of aborting a response on purpose.
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			panicsTotal.Inc()
+			attrs := []any{"path", r.URL.Path, "panic", v, "stack", string(debug.Stack())}
+			if l := requestLogFrom(r.Context()); l != nil {
+				attrs = append(attrs, "request_id", l.id)
+			}
+			slog.Error("panic serving request", attrs...)
+
+			// If the response is already underway, all we can do is cut it
+			// short.
+			if rec.code != 0 {
+				return
+			}
+			s.writeRequestError(rec, r, http.StatusInternalServerError, &requestError{
+				Category: categoryInternal,
+				Message:  "something went wrong looking this up",
+			})
+		}()
+		h.ServeHTTP(rec, r)
+	})
+}
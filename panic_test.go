@@ -0,0 +1,109 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRecoverPanics(t *testing.T) {
+	before := testutil.ToFloat64(panicsTotal)
+	h := newTestServer().recoverPanics(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		var m map[string]string
+		m["boom"] = "" // nil map write
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/lookup?image=foo", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status: got %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+	var body struct {
+		Error *requestError `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("response isn't a structured error: %v\n%s", err, w.Body)
+	}
+	if body.Error == nil || body.Error.Category != categoryInternal {
+		t.Errorf("error: got %+v, want category %q", body.Error, categoryInternal)
+	}
+	if strings.Contains(w.Body.String(), "nil map") {
+		t.Errorf("response leaks the panic:\n%s", w.Body)
+	}
+	if got := testutil.ToFloat64(panicsTotal) - before; got != 1 {
+		t.Errorf("panicsTotal: went up by %v, want 1", got)
+	}
+}
+
+func TestRecoverPanicsAfterWrite(t *testing.T) {
+	h := newTestServer().recoverPanics(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, "partial")
+		panic("boom")
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/lookup", nil))
+	// The response is cut short rather than having an error appended.
+	if w.Code != http.StatusOK || w.Body.String() != "partial" {
+		t.Errorf("got %d %q, want the partial response left alone", w.Code, w.Body)
+	}
+}
+
+func TestRecoverPanicsAbortHandler(t *testing.T) {
+	before := testutil.ToFloat64(panicsTotal)
+	h := newTestServer().recoverPanics(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+
+	defer func() {
+		if v := recover(); v != http.ErrAbortHandler {
+			t.Errorf("recovered %v, want http.ErrAbortHandler re-raised", v)
+		}
+		if got := testutil.ToFloat64(panicsTotal) - before; got != 0 {
+			t.Errorf("panicsTotal: went up by %v, want 0", got)
+		}
+	}()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
+
+func TestMalformedCertificateDoesNotPanic(t *testing.T) {
+	repo := newTestRepo(t)
+	d := pushImage(t, repo.Tag("latest"))
+	pushManifest(t, cosignTag(d, "sig"), artifact(t, signatureLayer(d, map[string]string{
+		"dev.sigstore.cosign/certificate": "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n",
+	})))
+
+	before := testutil.ToFloat64(panicsTotal)
+	s := newTestServer()
+	h := s.recoverPanics(http.HandlerFunc(s.handleIndex))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/?image="+url.QueryEscape(d.String()), nil))
+
+	if got := testutil.ToFloat64(panicsTotal) - before; got != 0 {
+		t.Errorf("panicsTotal: went up by %v, want 0", got)
+	}
+	if !strings.Contains(w.Body.String(), "error parsing cert") {
+		t.Errorf("page doesn't show the certificate error:\n%s", w.Body)
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/in-toto/in-toto-golang/in_toto"
+	slsa02 "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/v0.2"
+	slsa1 "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/v1"
+	"github.com/sigstore/cosign/v2/pkg/cosign/attestation"
+)
+
+// requirement is a predicate type that an image must have an attestation for.
+type requirement struct {
+	PredicateType string `json:"predicateType"`
+	Present       bool   `json:"present"`
+}
+
+// policyResult is the outcome of checking an image against a set of required
+// predicate types.
+type policyResult struct {
+	Pass         bool           `json:"pass"`
+	Requirements []*requirement `json:"requirements"`
+}
+
+// Missing returns the required predicate types with no matching attestation.
+func (p *policyResult) Missing() []string {
+	var out []string
+	for _, r := range p.Requirements {
+		if !r.Present {
+			out = append(out, r.PredicateType)
+		}
+	}
+	return out
+}
+
+// checkRequired reports which of the required predicate types are attested
+// to. For an index, an attestation on the index or any of its platforms
+// counts.
+func checkRequired(out *output, required []string) *policyResult {
+	have := make(map[string]bool)
+	for _, g := range out.Groups {
+		for _, m := range g.Data {
+			for _, s := range m.Data {
+				if s.PredicateType != "" {
+					have[s.PredicateType] = true
+				}
+			}
+		}
+	}
+
+	p := &policyResult{Pass: true}
+	for _, t := range required {
+		r := &requirement{PredicateType: t, Present: have[t]}
+		p.Pass = p.Pass && r.Present
+		p.Requirements = append(p.Requirements, r)
+	}
+	return p
+}
+
+// predicateTypeAliases are the short names for predicate types accepted by
+// cosign's --type flag.
+var predicateTypeAliases = map[string]string{
+	"custom":           attestation.CosignCustomProvenanceV01,
+	"slsaprovenance":   slsa02.PredicateSLSAProvenance,
+	"slsaprovenance02": slsa02.PredicateSLSAProvenance,
+	"slsaprovenance1":  slsa1.PredicateSLSAProvenance,
+	"spdx":             in_toto.PredicateSPDX,
+	"spdxjson":         in_toto.PredicateSPDX,
+	"cyclonedx":        in_toto.PredicateCycloneDX,
+	"link":             in_toto.PredicateLinkV1,
+	"vuln":             attestation.CosignVulnProvenanceV01,
+}
+
+// parsePredicateType expands a predicate type alias, or checks t is a URI.
+func parsePredicateType(t string) (string, error) {
+	if uri, ok := predicateTypeAliases[t]; ok {
+		return uri, nil
+	}
+	if _, err := url.ParseRequestURI(t); err != nil {
+		return "", fmt.Errorf("invalid predicate type %q: must be a URI or one of slsaprovenance, slsaprovenance02, slsaprovenance1, link, spdx, spdxjson, cyclonedx, vuln, custom", t)
+	}
+	return t, nil
+}
+
+// filterPredicateType returns a copy of out with only the attestations of
+// the given predicate type. Anything that isn't an attestation (signatures,
+// SBOMs etc.) is kept. out itself may be shared with the cache, so is left
+// alone.
+func filterPredicateType(out *output, predicateType string) *output {
+	filtered := *out
+	filtered.Groups = make([]*group, 0, len(out.Groups))
+	for _, g := range out.Groups {
+		fg := *g
+		fg.Data = make([]*manifest, 0, len(g.Data))
+		for _, m := range g.Data {
+			fm := *m
+			fm.Data = nil
+			for _, s := range m.Data {
+				if s.PredicateType == "" || s.PredicateType == predicateType {
+					fm.Data = append(fm.Data, s)
+				}
+			}
+			fg.Data = append(fg.Data, &fm)
+		}
+		filtered.Groups = append(filtered.Groups, &fg)
+	}
+	return &filtered
+}
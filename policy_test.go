@@ -0,0 +1,64 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestParsePredicateType(t *testing.T) {
+	for in, want := range map[string]string{
+		"slsaprovenance":                   "https://slsa.dev/provenance/v0.2",
+		"slsaprovenance1":                  "https://slsa.dev/provenance/v1",
+		"spdx":                             "https://spdx.dev/Document",
+		"https://example.com/predicate/v1": "https://example.com/predicate/v1",
+	} {
+		if got, err := parsePredicateType(in); err != nil || got != want {
+			t.Errorf("%s: got %q (%v), want %q", in, got, err, want)
+		}
+	}
+	if _, err := parsePredicateType("slsa"); err == nil {
+		t.Error("unknown alias: want an error")
+	}
+}
+
+func TestResolveRequire(t *testing.T) {
+	repo := newTestRepo(t)
+	d := pushImage(t, repo.Tag("latest"))
+	pushManifest(t, cosignTag(d, "att"), artifact(t, attestationLayer(t, d, "https://slsa.dev/provenance/v0.2", `{}`, nil)))
+
+	for _, tc := range []struct {
+		name    string
+		require []string
+		want    int
+	}{
+		{"uri", []string{"https://slsa.dev/provenance/v0.2"}, http.StatusOK},
+		{"alias", []string{"slsaprovenance"}, http.StatusOK},
+		{"missing", []string{"slsaprovenance", "spdx"}, http.StatusPreconditionFailed},
+		{"unknown", []string{"slsa"}, http.StatusBadRequest},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			out, code, err := resolve(t, newTestServer(), d.String(), url.Values{"require": tc.require, "strict": {"true"}})
+			if code != tc.want {
+				t.Fatalf("status: got %d (%v), want %d", code, err, tc.want)
+			}
+			if code == http.StatusOK && (out.Policy == nil || !out.Policy.Pass) {
+				t.Errorf("policy: got %+v, want a pass", out.Policy)
+			}
+		})
+	}
+}
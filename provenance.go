@@ -0,0 +1,142 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/in-toto/in-toto-golang/in_toto"
+	"github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/common"
+	slsa01 "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/v0.1"
+	slsa02 "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/v0.2"
+	slsa1 "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/v1"
+)
+
+// provenanceSummary is the human interesting subset of a SLSA provenance
+// predicate, normalized across SLSA versions.
+type provenanceSummary struct {
+	BuilderID string
+	BuildType string
+	// Source is the URI of the source the build was invoked from.
+	Source       string
+	SourceDigest string
+	EntryPoint   string
+	// Materials are the inputs to the build, formatted as "<uri>@<digest>".
+	Materials []string
+	// Reproducible is set if the provenance claims the build is reproducible.
+	// Only SLSA v0.1 and v0.2 carry this as metadata.reproducible - SLSA v1.0
+	// dropped the field, so we don't make any claims for it.
+	Reproducible bool
+}
+
+// parseProvenance summarizes an in-toto statement of the given predicate type.
+// If the predicate isn't a known SLSA provenance type, nil is returned.
+func parseProvenance(predicateType string, statement []byte) (*provenanceSummary, error) {
+	switch predicateType {
+	case slsa01.PredicateSLSAProvenance:
+		s := new(in_toto.ProvenanceStatementSLSA01)
+		if err := json.Unmarshal(statement, s); err != nil {
+			return nil, fmt.Errorf("error decoding provenance: %w", err)
+		}
+		p := s.Predicate
+		out := &provenanceSummary{
+			BuilderID:  p.Builder.ID,
+			BuildType:  p.Recipe.Type,
+			EntryPoint: p.Recipe.EntryPoint,
+			Materials:  materials(p.Materials),
+		}
+		// The recipe only points at which material contained the config.
+		if i := p.Recipe.DefinedInMaterial; i != nil && *i >= 0 && *i < len(p.Materials) {
+			out.Source = p.Materials[*i].URI
+			out.SourceDigest = formatDigest(p.Materials[*i].Digest)
+		}
+		out.Reproducible = p.Metadata != nil && p.Metadata.Reproducible
+		return out, nil
+	case slsa02.PredicateSLSAProvenance:
+		s := new(in_toto.ProvenanceStatementSLSA02)
+		if err := json.Unmarshal(statement, s); err != nil {
+			return nil, fmt.Errorf("error decoding provenance: %w", err)
+		}
+		p := s.Predicate
+		return &provenanceSummary{
+			BuilderID:    p.Builder.ID,
+			BuildType:    p.BuildType,
+			Source:       p.Invocation.ConfigSource.URI,
+			SourceDigest: formatDigest(p.Invocation.ConfigSource.Digest),
+			EntryPoint:   p.Invocation.ConfigSource.EntryPoint,
+			Materials:    materials(p.Materials),
+			Reproducible: p.Metadata != nil && p.Metadata.Reproducible,
+		}, nil
+	case slsa1.PredicateSLSAProvenance:
+		s := new(in_toto.ProvenanceStatementSLSA1)
+		if err := json.Unmarshal(statement, s); err != nil {
+			return nil, fmt.Errorf("error decoding provenance: %w", err)
+		}
+		p := s.Predicate
+		out := &provenanceSummary{
+			BuilderID: p.RunDetails.Builder.ID,
+			BuildType: p.BuildDefinition.BuildType,
+		}
+		for _, d := range p.BuildDefinition.ResolvedDependencies {
+			out.Materials = append(out.Materials, material(d.URI, d.Digest))
+		}
+		// v1 leaves the shape of the build invocation up to the build type,
+		// but by convention the first resolved dependency is the source that
+		// was built (this is what the GitHub generators and GCB produce).
+		if deps := p.BuildDefinition.ResolvedDependencies; len(deps) > 0 {
+			out.Source = deps[0].URI
+			out.SourceDigest = formatDigest(deps[0].Digest)
+		}
+		return out, nil
+	}
+	return nil, nil
+}
+
+func materials(m []common.ProvenanceMaterial) []string {
+	out := make([]string, 0, len(m))
+	for _, m := range m {
+		out = append(out, material(m.URI, m.Digest))
+	}
+	return out
+}
+
+func material(uri string, digest common.DigestSet) string {
+	if d := formatDigest(digest); d != "" {
+		return uri + "@" + d
+	}
+	return uri
+}
+
+// formatDigest renders a digest set as "<alg>:<value>", preferring the
+// strongest well known algorithm if there are several.
+func formatDigest(d common.DigestSet) string {
+	for _, alg := range []string{"sha512", "sha256", "sha1", "gitCommit"} {
+		if v, ok := d[alg]; ok {
+			return alg + ":" + v
+		}
+	}
+	// Otherwise pick one deterministically.
+	algs := make([]string, 0, len(d))
+	for alg := range d {
+		algs = append(algs, alg)
+	}
+	sort.Strings(algs)
+	for _, alg := range algs {
+		return alg + ":" + d[alg]
+	}
+	return ""
+}
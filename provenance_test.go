@@ -0,0 +1,81 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseProvenance(t *testing.T) {
+	for _, tt := range []struct {
+		name          string
+		predicateType string
+		statement     string
+		want          *provenanceSummary
+	}{{
+		name:          "slsa v0.2",
+		predicateType: "https://slsa.dev/provenance/v0.2",
+		statement: `{"predicate":{
+			"builder":{"id":"https://github.com/slsa-framework/slsa-github-generator/.github/workflows/generator_container_slsa3.yml@refs/tags/v1.9.0"},
+			"buildType":"https://github.com/slsa-framework/slsa-github-generator/container@v1",
+			"invocation":{"configSource":{"uri":"git+https://github.com/foo/bar@refs/heads/main","digest":{"sha1":"abc"},"entryPoint":".github/workflows/release.yaml"}},
+			"metadata":{"reproducible":true},
+			"materials":[{"uri":"git+https://github.com/foo/bar@refs/heads/main","digest":{"sha1":"abc"}},{"uri":"pkg:docker/golang@1.21"}]}}`,
+		want: &provenanceSummary{
+			BuilderID:    "https://github.com/slsa-framework/slsa-github-generator/.github/workflows/generator_container_slsa3.yml@refs/tags/v1.9.0",
+			BuildType:    "https://github.com/slsa-framework/slsa-github-generator/container@v1",
+			Source:       "git+https://github.com/foo/bar@refs/heads/main",
+			SourceDigest: "sha1:abc",
+			EntryPoint:   ".github/workflows/release.yaml",
+			Materials:    []string{"git+https://github.com/foo/bar@refs/heads/main@sha1:abc", "pkg:docker/golang@1.21"},
+			Reproducible: true,
+		},
+	}, {
+		name:          "slsa v1.0",
+		predicateType: "https://slsa.dev/provenance/v1",
+		statement: `{"predicate":{
+			"buildDefinition":{"buildType":"https://slsa-framework.github.io/github-actions-buildtypes/workflow/v1",
+				"resolvedDependencies":[{"uri":"git+https://github.com/foo/bar@refs/heads/main","digest":{"gitCommit":"abc"}},{"uri":"pkg:docker/golang@1.21","digest":{"sha256":"def"}}]},
+			"runDetails":{"builder":{"id":"https://github.com/actions/runner/github-hosted"}}}}`,
+		want: &provenanceSummary{
+			BuilderID:    "https://github.com/actions/runner/github-hosted",
+			BuildType:    "https://slsa-framework.github.io/github-actions-buildtypes/workflow/v1",
+			Source:       "git+https://github.com/foo/bar@refs/heads/main",
+			SourceDigest: "gitCommit:abc",
+			Materials:    []string{"git+https://github.com/foo/bar@refs/heads/main@gitCommit:abc", "pkg:docker/golang@1.21@sha256:def"},
+		},
+	}, {
+		name:          "not provenance",
+		predicateType: "https://spdx.dev/Document",
+		statement:     `{"predicate":{}}`,
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseProvenance(tt.predicateType, []byte(tt.statement))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseProvenanceMalformed(t *testing.T) {
+	if _, err := parseProvenance("https://slsa.dev/provenance/v1", []byte(`{"predicate":[]}`)); err == nil {
+		t.Error("want an error for a malformed predicate")
+	}
+}
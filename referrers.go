@@ -0,0 +1,93 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// referrersTransport remembers which registries don't support the OCI 1.1
+// referrers API, so that we don't probe them on every lookup.
+//
+// Registries that support the API return an (empty) index for any digest, so
+// a 404 or 400 means the API isn't there. go-containerregistry then falls back
+// to the referrers tag scheme; once we know a registry is unsupported, we
+// answer the probe with a 404 ourselves so it goes straight to the fallback.
+type referrersTransport struct {
+	base http.RoundTripper
+	// ttl is how long to remember a registry is unsupported for, so we notice
+	// if it gains support.
+	ttl time.Duration
+
+	mu          sync.Mutex
+	unsupported map[string]time.Time
+}
+
+func newReferrersTransport(base http.RoundTripper, ttl time.Duration) *referrersTransport {
+	return &referrersTransport{
+		base:        base,
+		ttl:         ttl,
+		unsupported: make(map[string]time.Time),
+	}
+}
+
+func (t *referrersTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if !isReferrersRequest(r) {
+		return t.base.RoundTrip(r)
+	}
+
+	host := r.URL.Host
+	t.mu.Lock()
+	expires, known := t.unsupported[host]
+	if known && time.Now().After(expires) {
+		delete(t.unsupported, host)
+		known = false
+	}
+	t.mu.Unlock()
+	if known {
+		return &http.Response{
+			Status:     http.StatusText(http.StatusNotFound),
+			StatusCode: http.StatusNotFound,
+			Proto:      r.Proto,
+			ProtoMajor: r.ProtoMajor,
+			ProtoMinor: r.ProtoMinor,
+			Header:     make(http.Header),
+			Body:       io.NopCloser(strings.NewReader("")),
+			Request:    r,
+		}, nil
+	}
+
+	resp, err := t.base.RoundTrip(r)
+	if err == nil && (resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusBadRequest) {
+		t.mu.Lock()
+		t.unsupported[host] = time.Now().Add(t.ttl)
+		t.mu.Unlock()
+	}
+	return resp, err
+}
+
+// isReferrersRequest reports whether r is a call to the referrers API, i.e.
+// GET /v2/<name>/referrers/<digest>.
+func isReferrersRequest(r *http.Request) bool {
+	if r.Method != http.MethodGet || !strings.HasPrefix(r.URL.Path, "/v2/") {
+		return false
+	}
+	rest, _, ok := strings.Cut(r.URL.Path[len("/v2/"):], "/referrers/")
+	return ok && rest != ""
+}
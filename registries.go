@@ -0,0 +1,88 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// registryPolicy restricts which registries can be looked up in. Denied
+// registries are refused even if they're also allowed; with no allowed
+// registries, anything not denied is.
+//
+// Patterns are registry hosts (with the port, if any), where * matches any
+// run of characters, e.g. *.gcr.io.
+type registryPolicy struct {
+	allow []string
+	deny  []string
+}
+
+// parseRegistryPatterns parses a comma-separated list of registry patterns.
+// Docker Hub can be given as docker.io, as people usually write it.
+func parseRegistryPatterns(s string) ([]string, error) {
+	var out []string
+	for _, p := range strings.Split(s, ",") {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if p == "" {
+			continue
+		}
+		if strings.Contains(p, "*") {
+			if _, err := path.Match(p, ""); err != nil || strings.Contains(p, "/") {
+				return nil, fmt.Errorf("invalid registry pattern %q", p)
+			}
+			out = append(out, p)
+			continue
+		}
+		reg, err := name.NewRegistry(p)
+		if err != nil || strings.Contains(p, "/") {
+			return nil, fmt.Errorf("invalid registry %q", p)
+		}
+		out = append(out, reg.RegistryStr())
+	}
+	return out, nil
+}
+
+// allowed reports whether lookups may be made in reg.
+func (p *registryPolicy) allowed(reg name.Registry) bool {
+	if p == nil {
+		return true
+	}
+	host := strings.ToLower(reg.RegistryStr())
+	if matchRegistry(p.deny, host) {
+		return false
+	}
+	return len(p.allow) == 0 || matchRegistry(p.allow, host)
+}
+
+func matchRegistry(patterns []string, host string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, host); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRegistry returns an error if lookups may not be made in reg.
+func (p *registryPolicy) checkRegistry(reg name.Registry) error {
+	if !p.allowed(reg) {
+		return fmt.Errorf("registry %s is not allowed on this server", reg.RegistryStr())
+	}
+	return nil
+}
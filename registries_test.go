@@ -0,0 +1,82 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+func TestParseRegistryPatterns(t *testing.T) {
+	got, err := parseRegistryPatterns(" GHCR.io, *.gcr.io,,docker.io,localhost:5000 ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"ghcr.io", "*.gcr.io", "index.docker.io", "localhost:5000"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	for _, s := range []string{"ghcr.io/foo", "*.gcr.io/foo", "[*.gcr.io", "not a registry"} {
+		if _, err := parseRegistryPatterns(s); err == nil {
+			t.Errorf("%q: want an error", s)
+		}
+	}
+}
+
+func TestRegistryPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		policy *registryPolicy
+		reg    string
+		want   bool
+	}{
+		{"no policy", nil, "example.com", true},
+		{"default open", &registryPolicy{deny: []string{"evil.example"}}, "example.com", true},
+		{"denied", &registryPolicy{deny: []string{"evil.example"}}, "evil.example", false},
+		{"allowed", &registryPolicy{allow: []string{"ghcr.io"}}, "ghcr.io", true},
+		{"not allowed", &registryPolicy{allow: []string{"ghcr.io"}}, "quay.io", false},
+		{"wildcard", &registryPolicy{allow: []string{"*.gcr.io"}}, "us.gcr.io", true},
+		{"wildcard is a suffix", &registryPolicy{allow: []string{"*.gcr.io"}}, "gcr.io", false},
+		{"case insensitive", &registryPolicy{allow: []string{"ghcr.io"}}, "GHCR.IO", true},
+		{"port", &registryPolicy{allow: []string{"localhost:5000"}}, "localhost:5001", false},
+		{"deny beats allow", &registryPolicy{allow: []string{"*.gcr.io"}, deny: []string{"eu.gcr.io"}}, "eu.gcr.io", false},
+		{"docker hub", &registryPolicy{allow: []string{"index.docker.io"}}, "docker.io", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			reg, err := name.NewRegistry(tc.reg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := tc.policy.allowed(reg); got != tc.want {
+				t.Errorf("allowed(%s): got %v, want %v", tc.reg, got, tc.want)
+			}
+			if err := tc.policy.checkRegistry(reg); (err == nil) != tc.want {
+				t.Errorf("checkRegistry(%s): got %v", tc.reg, err)
+			}
+		})
+	}
+}
+
+func TestResolveDeniedRegistry(t *testing.T) {
+	s := newTestServer()
+	s.registries = &registryPolicy{allow: []string{"ghcr.io"}}
+	if _, code, err := resolve(t, s, "quay.io/foo/bar:latest", nil); code != http.StatusForbidden {
+		t.Errorf("got %d (%v), want %d", code, err, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gomarkdown/markdown/ast"
+	"github.com/gomarkdown/markdown/html"
+	"github.com/gomarkdown/markdown/parser"
+	"golang.org/x/exp/slog"
+)
+
+// htmlPage is an HTML page being streamed to the client, rendered from a
+// markdown template.
+type htmlPage struct {
+	w        http.ResponseWriter
+	renderer *html.Renderer
+	max      int
+}
+
+// startPage sends the status code and the top of the page, up to and
+// including <body>, for the body to be rendered into later. It's flushed
+// straight away, so the client can start on the stylesheet and favicon
+// before the body is ready.
+func (s *server) startPage(w http.ResponseWriter, r *http.Request, code int) *htmlPage {
+	// Render markdown, then pass to html/template.
+	// This was just easier to prototype than trying to deal with html/css.
+	opts := html.RendererOptions{
+		Title: r.Host,
+		Flags: html.CommonFlags | html.HrefTargetBlank | html.CompletePage,
+		CSS:   "https://cdn.simplecss.org/simple.min.css",
+		Head:  []byte(faviconLink + "\n"),
+	}
+	p := &htmlPage{w: w, renderer: html.NewRenderer(opts), max: s.maxPageSize}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+	p.renderer.RenderHeader(w, nil)
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return p
+}
+
+// render renders the named markdown template with data as the body of the
+// page, and finishes it.
+func (p *htmlPage) render(name string, data any) {
+	sw := newSectionWriter(p.w, p.renderer, p.max)
+	if err := tmpl.ExecuteTemplate(sw, name, data); err != nil {
+		// All we can do by now is cut the page short.
+		slog.Error("failed to render page", "template", name, "error", err)
+	}
+	sw.Close()
+	p.renderer.RenderFooter(p.w, nil)
+}
+
+const markdownExtensions = parser.CommonExtensions | parser.AutoHeadingIDs | parser.NoEmptyLineBeforeBlock | parser.Tables
+
+// sectionSep starts each section of a page: a top-level heading.
+var sectionSep = []byte("\n## ")
+
+// sectionWriter renders markdown to HTML a section at a time as it's written,
+// flushing each section to the client as soon as it's rendered. Pages with
+// many signatures can run to megabytes, and this way neither the whole
+// markdown document nor its parse tree has to be held at once.
+//
+// Sections start at each "## " heading. The templates keep HTML blocks (e.g.
+// <details>) within a section, so that each section parses on its own.
+type sectionWriter struct {
+	w        io.Writer
+	renderer *html.Renderer
+	// max is how many bytes of markdown are rendered before the rest is
+	// dropped, if set.
+	max       int
+	n         int
+	truncated bool
+	buf       bytes.Buffer
+	// ids are the heading IDs used so far, so that they're unique across the
+	// page as they would be within a single document.
+	ids map[string]bool
+}
+
+func newSectionWriter(w io.Writer, renderer *html.Renderer, max int) *sectionWriter {
+	return &sectionWriter{w: w, renderer: renderer, max: max, ids: map[string]bool{}}
+}
+
+func (sw *sectionWriter) Write(p []byte) (int, error) {
+	if sw.truncated {
+		return len(p), nil
+	}
+	// Only look for a separator where the new bytes could complete one.
+	from := max(sw.buf.Len()-len(sectionSep)+1, 0)
+	sw.buf.Write(p)
+	for !sw.truncated {
+		i := bytes.Index(sw.buf.Bytes()[from:], sectionSep)
+		if i < 0 {
+			break
+		}
+		// Keep the newline with the section it ends.
+		section := bytes.Clone(sw.buf.Next(from + i + 1))
+		sw.render(section)
+		from = 0
+	}
+	return len(p), nil
+}
+
+// Close renders whatever is left of the page.
+func (sw *sectionWriter) Close() {
+	if !sw.truncated && sw.buf.Len() > 0 {
+		sw.render(bytes.Clone(sw.buf.Bytes()))
+	}
+	sw.buf.Reset()
+}
+
+func (sw *sectionWriter) render(section []byte) {
+	if sw.max > 0 && sw.n+len(section) > sw.max {
+		b := bytes.NewBuffer(section)
+		truncateMarkdown(b, sw.max-sw.n, sw.max)
+		section = b.Bytes()
+		sw.truncated = true
+	}
+	sw.n += len(section)
+	if os.Getenv("DEBUG") != "" {
+		fmt.Print(string(section))
+	}
+
+	doc := parser.NewWithExtensions(markdownExtensions).Parse(section)
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		if h, ok := node.(*ast.Heading); ok && entering && h.HeadingID != "" {
+			id := h.HeadingID
+			for n := 1; sw.ids[id]; n++ {
+				id = h.HeadingID + "-" + strconv.Itoa(n)
+			}
+			h.HeadingID = id
+			sw.ids[id] = true
+		}
+		return sw.renderer.RenderNode(sw.w, node, entering)
+	})
+	if f, ok := sw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
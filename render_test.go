@@ -0,0 +1,217 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/sigstore/fulcio/pkg/certificate"
+)
+
+// pushSignedImage pushes an image to repo with a keyless signature and n SLSA
+// provenance attestations, as a larger project's release image might have.
+func pushSignedImage(t testing.TB, repo name.Repository, n int) name.Digest {
+	t.Helper()
+	d := pushImage(t, repo.Tag("latest"))
+
+	workflow := "https://github.com/foo/bar/.github/workflows/release.yaml@refs/heads/main"
+	uri, err := url.Parse(workflow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ext, err := certificate.Extensions{
+		Issuer:                 "https://token.actions.githubusercontent.com",
+		SourceRepositoryURI:    "https://github.com/foo/bar",
+		SourceRepositoryDigest: strings.Repeat("ab", 20),
+		BuildConfigURI:         workflow,
+		RunInvocationURI:       "https://github.com/foo/bar/actions/runs/1/attempts/1",
+	}.Render()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, cert := newTestCert(t, &x509.Certificate{URIs: []*url.URL{uri}, ExtraExtensions: ext})
+	annotations := map[string]string{
+		"dev.sigstore.cosign/certificate": cert,
+		"dev.sigstore.cosign/bundle":      rekorBundle(1234, time.Now()),
+	}
+
+	pushManifest(t, cosignTag(d, "sig"), artifact(t, signatureLayer(d, annotations)))
+	var atts []mutate.Addendum
+	for i := 0; i < n; i++ {
+		predicate := fmt.Sprintf(`{"builder":{"id":%q},"buildType":"https://github.com/Attestations/GitHubActionsWorkflow@v1","invocation":{"configSource":{"uri":"git+https://github.com/foo/bar@refs/heads/main","digest":{"sha1":"%040d"},"entryPoint":".github/workflows/release.yaml"}}}`, workflow, i)
+		atts = append(atts, attestationLayer(t, d, "https://slsa.dev/provenance/v0.2", predicate, annotations))
+	}
+	pushManifest(t, cosignTag(d, "att"), artifact(t, atts...))
+	return d
+}
+
+func BenchmarkRender(b *testing.B) {
+	repo := newTestRepo(b)
+	d := pushSignedImage(b, repo, 40)
+	out, err := handleRef(context.Background(), d, lookupOptions{discovery: discoveryBoth})
+	if err != nil {
+		b.Fatal(err)
+	}
+	s := newTestServer()
+	r := httptest.NewRequest(http.MethodGet, "/?image="+d.String(), nil)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.renderMarkdown(httptest.NewRecorder(), r, http.StatusOK, "template.md", out)
+	}
+}
+
+// BenchmarkTimeToFirstByte measures how long browsers wait for the first byte
+// of a results page, against a registry that takes a while to answer.
+func BenchmarkTimeToFirstByte(b *testing.B) {
+	host := newTestRegistryWith(b, func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(time.Millisecond)
+			h.ServeHTTP(w, r)
+		})
+	})
+	repo, err := name.NewRepository(host + "/foo/bar")
+	if err != nil {
+		b.Fatal(err)
+	}
+	d := pushSignedImage(b, repo, 10)
+	srv := httptest.NewServer(http.HandlerFunc(newTestServer().handleIndex))
+	b.Cleanup(srv.Close)
+
+	var ttfb time.Duration
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		start := time.Now()
+		resp, err := http.Get(srv.URL + "/?image=" + url.QueryEscape(d.String()))
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := resp.Body.Read(make([]byte, 1)); err != nil {
+			b.Fatal(err)
+		}
+		ttfb += time.Since(start)
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	b.ReportMetric(float64(ttfb.Nanoseconds())/float64(b.N), "ns-ttfb/op")
+}
+
+func TestPageFailedLookupStatus(t *testing.T) {
+	// The registry hangs fetching signatures, to time the lookup out.
+	release := make(chan struct{})
+	host := newTestRegistryWith(t, func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasSuffix(r.URL.Path, ".sig") {
+				select {
+				case <-r.Context().Done():
+				case <-release:
+				}
+				return
+			}
+			h.ServeHTTP(w, r)
+		})
+	})
+	t.Cleanup(func() { close(release) })
+	repo, err := name.NewRepository(host + "/foo/bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := pushImage(t, repo.Tag("latest"))
+
+	for _, tc := range []struct {
+		name  string
+		image string
+		setup func(*server)
+		want  int
+	}{
+		{"missing", repo.Tag("missing").String(), nil, http.StatusNotFound},
+		{"denied", d.String(), func(s *server) { s.registries = &registryPolicy{deny: []string{"127.0.0.1:*"}} }, http.StatusForbidden},
+		{"timeout", d.String(), func(s *server) { s.timeout = 50 * time.Millisecond }, http.StatusGatewayTimeout},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestServer()
+			if tc.setup != nil {
+				tc.setup(s)
+			}
+			w := httptest.NewRecorder()
+			s.recoverPanics(http.HandlerFunc(s.handleIndex)).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/?image="+url.QueryEscape(tc.image), nil))
+			if w.Code != tc.want {
+				t.Errorf("status: got %d, want %d", w.Code, tc.want)
+			}
+			if body := w.Body.String(); strings.Count(body, "<body>") != 1 {
+				t.Errorf("want a single error page, got:\n%s", body)
+			}
+		})
+	}
+}
+
+func TestPageStrictWaitsForStatus(t *testing.T) {
+	repo := newTestRepo(t)
+	d := pushImage(t, repo.Tag("latest"))
+	q := url.Values{"image": {d.String()}, "require": {"https://slsa.dev/provenance/v1"}, "strict": {"true"}}
+	w := httptest.NewRecorder()
+	newTestServer().handleIndex(w, httptest.NewRequest(http.MethodGet, "/?"+q.Encode(), nil))
+	if w.Code != http.StatusPreconditionFailed {
+		t.Errorf("status: got %d, want %d", w.Code, http.StatusPreconditionFailed)
+	}
+}
+
+func TestSectionWriter(t *testing.T) {
+	w := httptest.NewRecorder()
+	p := newTestServer().startPage(w, httptest.NewRequest(http.MethodGet, "/", nil), http.StatusOK)
+	sw := newSectionWriter(w, p.renderer, 0)
+	io.WriteString(sw, "# Title\n\n## Signatures\n\nOne.\n\n## Signatures\n\nTwo.\n")
+	sw.Close()
+
+	got := w.Body.String()
+	// Heading IDs stay unique across sections, as within one document.
+	for _, id := range []string{`id="signatures"`, `id="signatures-1"`} {
+		if !strings.Contains(got, id) {
+			t.Errorf("missing heading %s in:\n%s", id, got)
+		}
+	}
+}
+
+func TestSectionWriterTruncates(t *testing.T) {
+	var b strings.Builder
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(&b, "\n## Section %d\n\nSome text.\n", i)
+	}
+	w := httptest.NewRecorder()
+	p := newTestServer().startPage(w, httptest.NewRequest(http.MethodGet, "/", nil), http.StatusOK)
+	sw := newSectionWriter(w, p.renderer, 500)
+	io.WriteString(sw, b.String())
+	sw.Close()
+
+	got := w.Body.String()
+	if !strings.Contains(got, "Output truncated") {
+		t.Error("page wasn't truncated")
+	}
+	if strings.Contains(got, "Section 99") {
+		t.Error("page has content past the limit")
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// SBOM attestation predicate types, as produced by e.g. `cosign attest
+// --type cyclonedx` or `--type spdxjson`. Either may have a version suffix,
+// e.g. https://spdx.dev/Document/v2.3.
+const (
+	predicateCycloneDX = "https://cyclonedx.org/bom"
+	predicateSPDX      = "https://spdx.dev/Document"
+)
+
+func isSBOMPredicate(predicateType string) bool {
+	return strings.HasPrefix(predicateType, predicateCycloneDX) || strings.HasPrefix(predicateType, predicateSPDX)
+}
+
+// sbomSummary is the headline of a CycloneDX or SPDX document.
+type sbomSummary struct {
+	Format      string
+	SpecVersion string
+	// Name is the SPDX document name, or the CycloneDX metadata component.
+	Name string
+	// Components is the number of CycloneDX components (including nested
+	// ones) or SPDX packages.
+	Components int
+	// Tools are the tools that generated the document, if it says.
+	Tools []string
+}
+
+// String renders the summary, e.g. "CycloneDX 1.5, 42 components".
+func (s *sbomSummary) String() string {
+	noun := "components"
+	if s.Format == "SPDX" {
+		noun = "packages"
+	}
+	return fmt.Sprintf("%s %s, %d %s", s.Format, s.SpecVersion, s.Components, noun)
+}
+
+// cdxComponent is a CycloneDX component, which can have components of its
+// own.
+type cdxComponent struct {
+	Name       string         `json:"name"`
+	Version    string         `json:"version"`
+	Components []cdxComponent `json:"components"`
+}
+
+func countComponents(cs []cdxComponent) int {
+	n := len(cs)
+	for _, c := range cs {
+		n += countComponents(c.Components)
+	}
+	return n
+}
+
+// parseSBOMStatement summarizes the SBOM in the predicate of an in-toto
+// statement. Some tools carry the document as a JSON string rather than an
+// object.
+func parseSBOMStatement(body []byte) (*sbomSummary, error) {
+	var stmt struct {
+		Predicate json.RawMessage `json:"predicate"`
+	}
+	if err := json.Unmarshal(body, &stmt); err != nil {
+		return nil, fmt.Errorf("error decoding sbom predicate: %w", err)
+	}
+	doc := []byte(stmt.Predicate)
+	var s string
+	if err := json.Unmarshal(doc, &s); err == nil {
+		doc = []byte(s)
+	}
+	return parseSBOM(doc)
+}
+
+// parseSBOM summarizes a CycloneDX or SPDX JSON document. Documents are
+// bounded by maxLayerSize, as they're read from a layer.
+func parseSBOM(b []byte) (*sbomSummary, error) {
+	var doc struct {
+		// CycloneDX
+		BOMFormat   string `json:"bomFormat"`
+		SpecVersion string `json:"specVersion"`
+		Metadata    struct {
+			Component cdxComponent `json:"component"`
+			// Tools is a list of tools up to CycloneDX 1.4, and an object
+			// of components and services from 1.5.
+			Tools json.RawMessage `json:"tools"`
+		} `json:"metadata"`
+		Components []cdxComponent `json:"components"`
+		// SPDX
+		SPDXVersion  string     `json:"spdxVersion"`
+		Name         string     `json:"name"`
+		Packages     []struct{} `json:"packages"`
+		CreationInfo struct {
+			Creators []string `json:"creators"`
+		} `json:"creationInfo"`
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("error decoding sbom: %w", err)
+	}
+
+	switch {
+	case doc.BOMFormat == "CycloneDX":
+		s := &sbomSummary{
+			Format:      "CycloneDX",
+			SpecVersion: doc.SpecVersion,
+			Name:        doc.Metadata.Component.Name,
+			Components:  countComponents(doc.Components),
+		}
+		var tools []cdxComponent
+		if err := json.Unmarshal(doc.Metadata.Tools, &tools); err != nil {
+			var v15 struct {
+				Components []cdxComponent `json:"components"`
+			}
+			json.Unmarshal(doc.Metadata.Tools, &v15)
+			tools = v15.Components
+		}
+		for _, t := range tools {
+			s.Tools = append(s.Tools, strings.TrimSpace(t.Name+" "+t.Version))
+		}
+		return s, nil
+	case strings.HasPrefix(doc.SPDXVersion, "SPDX-"):
+		s := &sbomSummary{
+			Format:      "SPDX",
+			SpecVersion: strings.TrimPrefix(doc.SPDXVersion, "SPDX-"),
+			Name:        doc.Name,
+			Components:  len(doc.Packages),
+		}
+		for _, c := range doc.CreationInfo.Creators {
+			if tool, ok := strings.CutPrefix(c, "Tool: "); ok {
+				s.Tools = append(s.Tools, tool)
+			}
+		}
+		return s, nil
+	}
+	return nil, errors.New("unknown sbom format")
+}
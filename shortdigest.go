@@ -0,0 +1,153 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"golang.org/x/exp/slog"
+)
+
+// minShortDigest is the shortest digest prefix we'll try to resolve. Any
+// shorter and nearly every lookup would be ambiguous.
+const minShortDigest = 6
+
+var (
+	errDigestNotFound  = errors.New("no manifest matches digest prefix")
+	errAmbiguousDigest = errors.New("digest prefix is ambiguous")
+)
+
+// splitShortDigest splits image into its repository and digest prefix if it
+// is of the form repo@[sha256:]<hex>, with fewer hex characters than a full
+// sha256 digest.
+func splitShortDigest(image string) (repo, prefix string, ok bool) {
+	repo, d, ok := strings.Cut(image, "@")
+	if !ok {
+		return "", "", false
+	}
+	d = strings.TrimPrefix(d, "sha256:")
+	if len(d) < minShortDigest || len(d) >= 64 || strings.Trim(d, "0123456789abcdef") != "" {
+		return "", "", false
+	}
+	return repo, d, true
+}
+
+// resolveShortDigest finds the manifest in repo whose sha256 digest starts
+// with prefix. Registries can't list manifests directly, so this lists the
+// repository's tags and resolves each one, which can take a lot of requests.
+// Tags following cosign's sha256-<digest> scheme name the image they're
+// attached to, so those are used as-is rather than resolved.
+func resolveShortDigest(ctx context.Context, repo name.Repository, prefix string, opts ...remote.Option) (name.Digest, error) {
+	tags, err := remote.List(repo, opts...)
+	if err != nil {
+		return name.Digest{}, fmt.Errorf("error listing tags of %s to resolve digest prefix %s, try the full digest instead: %w", repo, prefix, err)
+	}
+
+	seen := map[string]bool{}
+	for _, t := range tags {
+		if d, ok := cosignTagDigest(t); ok {
+			seen[d] = true
+			continue
+		}
+		desc, err := remote.Head(repo.Tag(t), opts...)
+		if err != nil {
+			if err := giveUpError(ctx, err); err != nil {
+				return name.Digest{}, fmt.Errorf("error resolving tags of %s to resolve digest prefix %s, try the full digest instead: %w", repo, prefix, err)
+			}
+			slog.Warn("failed to resolve tag", "repo", repo.String(), "tag", t, "error", err)
+			continue
+		}
+		seen[desc.Digest.String()] = true
+	}
+
+	var matches []string
+	for d := range seen {
+		if strings.HasPrefix(d, "sha256:"+prefix) {
+			matches = append(matches, d)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return name.Digest{}, fmt.Errorf("%w %s in %s", errDigestNotFound, prefix, repo)
+	case 1:
+		return repo.Digest(matches[0]), nil
+	}
+	slices.Sort(matches)
+	return name.Digest{}, fmt.Errorf("%w: %s matches %s", errAmbiguousDigest, prefix, strings.Join(matches, ", "))
+}
+
+// giveUpError returns the error to stop resolving tags with, if err from
+// resolving one of them means the rest won't resolve either: the lookup has
+// timed out or run out of requests.
+func giveUpError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if errors.Is(err, errBudgetExceeded) {
+		return errBudgetExceeded
+	}
+	return nil
+}
+
+// cosignTagDigest returns the digest of the image a cosign signature,
+// attestation or SBOM tag (e.g. sha256-<hex>.sig) is attached to.
+func cosignTagDigest(tag string) (string, bool) {
+	hex, ok := strings.CutPrefix(tag, "sha256-")
+	if !ok {
+		return "", false
+	}
+	hex, _, _ = strings.Cut(hex, ".")
+	if len(hex) != 64 || strings.Trim(hex, "0123456789abcdef") != "" {
+		return "", false
+	}
+	return "sha256:" + hex, true
+}
+
+// tagsOf returns the tags in repo that currently point at digest, by listing
+// and resolving every tag like resolveShortDigest does. cosign's own tags
+// are skipped, since they never point at the image itself. Tags that fail
+// to resolve are skipped too, so the result may be incomplete.
+func tagsOf(ctx context.Context, repo name.Repository, digest string, opts ...remote.Option) ([]string, error) {
+	tags, err := remote.List(repo, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error listing tags of %s: %w", repo, err)
+	}
+
+	var matches []string
+	for _, t := range tags {
+		if _, ok := cosignTagDigest(t); ok {
+			continue
+		}
+		desc, err := remote.Head(repo.Tag(t), opts...)
+		if err != nil {
+			if err := giveUpError(ctx, err); err != nil {
+				return matches, err
+			}
+			slog.Warn("failed to resolve tag", "repo", repo.String(), "tag", t, "error", err)
+			continue
+		}
+		if desc.Digest.String() == digest {
+			matches = append(matches, t)
+		}
+	}
+	slices.Sort(matches)
+	return matches, nil
+}
@@ -0,0 +1,95 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// pushTags pushes n images to repo, tagged v0 to v<n-1>, returning the
+// digest of the last.
+func pushTags(t *testing.T, repo name.Repository, n int) name.Digest {
+	t.Helper()
+	var d name.Digest
+	for i := 0; i < n; i++ {
+		d = pushImage(t, repo.Tag(fmt.Sprintf("v%d", i)))
+	}
+	return d
+}
+
+func budgetOptions(ctx context.Context) []remote.Option {
+	return []remote.Option{remote.WithContext(ctx), remote.WithTransport(&budgetTransport{base: remote.DefaultTransport})}
+}
+
+func TestResolveShortDigest(t *testing.T) {
+	repo := newTestRepo(t)
+	d := pushTags(t, repo, 3)
+	prefix := d.DigestStr()[len("sha256:"):][:12]
+
+	got, err := resolveShortDigest(context.Background(), repo, prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != d {
+		t.Errorf("got %s, want %s", got, d)
+	}
+	if _, err := resolveShortDigest(context.Background(), repo, "000000"); !errors.Is(err, errDigestNotFound) {
+		t.Errorf("got %v, want %v", err, errDigestNotFound)
+	}
+}
+
+func TestResolveShortDigestBudget(t *testing.T) {
+	repo := newTestRepo(t)
+	d := pushTags(t, repo, 10)
+	prefix := d.DigestStr()[len("sha256:"):][:12]
+
+	ctx := withBudget(context.Background(), 5)
+	_, err := resolveShortDigest(ctx, repo, prefix, budgetOptions(ctx)...)
+	if !errors.Is(err, errBudgetExceeded) {
+		t.Errorf("got %v, want %v", err, errBudgetExceeded)
+	}
+
+	s := newTestServer()
+	s.allowShortDigests = true
+	s.budget = 5
+	s.transport = &budgetTransport{base: remote.DefaultTransport}
+	if _, code, err := resolve(t, s, repo.String()+"@"+prefix, nil); code == http.StatusNotFound || !errors.Is(err, errBudgetExceeded) {
+		t.Errorf("got %d (%v), want the budget error", code, err)
+	}
+}
+
+func TestTagsOfBudget(t *testing.T) {
+	repo := newTestRepo(t)
+	d := pushTags(t, repo, 10)
+
+	ctx := withBudget(context.Background(), 5)
+	if _, err := tagsOf(ctx, repo, d.DigestStr(), budgetOptions(ctx)...); !errors.Is(err, errBudgetExceeded) {
+		t.Errorf("got %v, want %v", err, errBudgetExceeded)
+	}
+	tags, err := tagsOf(context.Background(), repo, d.DigestStr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 1 || tags[0] != "v9" {
+		t.Errorf("got %q, want [v9]", tags)
+	}
+}
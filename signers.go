@@ -0,0 +1,130 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// signer is an identity that has signed (or attested to) an image.
+type signer struct {
+	Identity string
+	// First and Last are the Rekor integrated times of the identity's
+	// earliest and latest signatures.
+	First, Last time.Time
+	Count       int
+}
+
+// signerChange is a point at which the identity signing an image changed,
+// e.g. because the release workflow moved.
+type signerChange struct {
+	At       time.Time
+	From, To string
+}
+
+// signerTimeline is who has signed an image over time.
+type signerTimeline struct {
+	// Signers are ordered by when they first signed.
+	Signers []signer
+	Changes []signerChange
+}
+
+// signersOf builds the signer timeline of out from its Fulcio identities and
+// Rekor times. Signatures without either can't be placed on the timeline, so
+// are skipped.
+func signersOf(out *output) *signerTimeline {
+	type entry struct {
+		identity string
+		at       time.Time
+	}
+	var entries []entry
+	for _, g := range out.Groups {
+		for _, m := range g.Data {
+			for _, d := range m.Data {
+				if d.Cert == nil || d.Bundle == nil || d.Bundle.Payload.IntegratedTime <= 0 {
+					continue
+				}
+				entries = append(entries, entry{subjectAltName(d.Cert), unixTime(d.Bundle.Payload.IntegratedTime)})
+			}
+		}
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].at.Before(entries[j].at) })
+
+	t := &signerTimeline{}
+	index := map[string]int{}
+	for i, e := range entries {
+		n, ok := index[e.identity]
+		if !ok {
+			n = len(t.Signers)
+			index[e.identity] = n
+			t.Signers = append(t.Signers, signer{Identity: e.identity, First: e.at})
+		}
+		t.Signers[n].Last = e.at
+		t.Signers[n].Count++
+
+		if i > 0 && entries[i-1].identity != e.identity {
+			t.Changes = append(t.Changes, signerChange{At: e.at, From: entries[i-1].identity, To: e.identity})
+		}
+	}
+	return t
+}
+
+// signerGroup is the signatures of a manifest made by one identity.
+type signerGroup struct {
+	// Identity and Issuer are empty for signatures without a Fulcio
+	// certificate, e.g. those made with a key.
+	Identity, Issuer string
+	Count            int
+	// First and Last are the Rekor integrated times of the identity's
+	// earliest and latest signatures, if known.
+	First, Last time.Time
+}
+
+// signerGroupsOf groups the signatures of m by who made them, in the order
+// each identity first appears.
+func signerGroupsOf(m *manifest) []signerGroup {
+	var groups []signerGroup
+	index := map[[2]string]int{}
+	for _, d := range m.Data {
+		var g signerGroup
+		if d.Cert != nil {
+			g.Identity, g.Issuer = subjectAltName(d.Cert), d.Extensions.Issuer
+		}
+		key := [2]string{g.Identity, g.Issuer}
+		n, ok := index[key]
+		if !ok {
+			n = len(groups)
+			index[key] = n
+			groups = append(groups, g)
+		}
+		groups[n].Count++
+
+		if d.Bundle == nil || d.Bundle.Payload.IntegratedTime <= 0 {
+			continue
+		}
+		at := unixTime(d.Bundle.Payload.IntegratedTime)
+		if groups[n].First.IsZero() || at.Before(groups[n].First) {
+			groups[n].First = at
+		}
+		if at.After(groups[n].Last) {
+			groups[n].Last = at
+		}
+	}
+	return groups
+}
@@ -0,0 +1,209 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/secure-systems-lab/go-securesystemslib/dsse"
+	"github.com/sigstore/cosign/v2/pkg/cosign/bundle"
+	"github.com/sigstore/rekor/pkg/generated/models"
+)
+
+// sigstoreBundleMediaType prefixes the media types of sigstore bundles, e.g.
+// application/vnd.dev.sigstore.bundle+json;version=0.2 or
+// application/vnd.dev.sigstore.bundle.v0.3+json.
+const sigstoreBundleMediaType = "application/vnd.dev.sigstore.bundle"
+
+func isSigstoreBundle(mt string) bool {
+	return strings.HasPrefix(mt, sigstoreBundleMediaType)
+}
+
+// sigstoreBundle is the JSON encoding of the sigstore bundle protobuf
+// (dev.sigstore.bundle.v1.Bundle), covering just the fields we show. Bytes
+// fields are base64 encoded and int64s are strings, as protojson does.
+type sigstoreBundle struct {
+	VerificationMaterial struct {
+		// X509CertificateChain is used up to v0.2 of the bundle, and
+		// Certificate from v0.3.
+		X509CertificateChain *struct {
+			Certificates []struct {
+				RawBytes []byte `json:"rawBytes"`
+			} `json:"certificates"`
+		} `json:"x509CertificateChain"`
+		Certificate *struct {
+			RawBytes []byte `json:"rawBytes"`
+		} `json:"certificate"`
+		TlogEntries []struct {
+			LogIndex string `json:"logIndex"`
+			LogID    struct {
+				KeyID []byte `json:"keyId"`
+			} `json:"logId"`
+			IntegratedTime   string `json:"integratedTime"`
+			InclusionPromise *struct {
+				SignedEntryTimestamp []byte `json:"signedEntryTimestamp"`
+			} `json:"inclusionPromise"`
+			InclusionProof *struct {
+				LogIndex   string   `json:"logIndex"`
+				RootHash   []byte   `json:"rootHash"`
+				TreeSize   string   `json:"treeSize"`
+				Hashes     [][]byte `json:"hashes"`
+				Checkpoint struct {
+					Envelope string `json:"envelope"`
+				} `json:"checkpoint"`
+			} `json:"inclusionProof"`
+			CanonicalizedBody []byte `json:"canonicalizedBody"`
+		} `json:"tlogEntries"`
+	} `json:"verificationMaterial"`
+	// A bundle holds either a DSSE envelope or a signature made directly
+	// over the artifact.
+	DSSEEnvelope     *dsse.Envelope `json:"dsseEnvelope"`
+	MessageSignature *struct {
+		MessageDigest struct {
+			Algorithm string `json:"algorithm"`
+			Digest    []byte `json:"digest"`
+		} `json:"messageDigest"`
+		Signature []byte `json:"signature"`
+	} `json:"messageSignature"`
+}
+
+// messageSignature is a sigstore bundle's signature over an artifact (rather
+// than over a DSSE envelope).
+type messageSignature struct {
+	// Digest is the digest of the signed artifact, e.g. sha256:abc...
+	Digest    string
+	Signature []byte
+}
+
+// bundleHashAlgorithms maps the protobuf HashAlgorithm names to the algorithm
+// prefixes of OCI digests.
+var bundleHashAlgorithms = map[string]string{
+	"SHA2_256": "sha256",
+	"SHA2_384": "sha384",
+	"SHA2_512": "sha512",
+	"SHA3_256": "sha3-256",
+	"SHA3_384": "sha3-384",
+}
+
+// parseProtoInt parses a protojson int64. Zero values are omitted entirely,
+// so an empty string is 0.
+func parseProtoInt(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
+
+// setSigstoreBundle fills in s from the sigstore bundle b, the same way the
+// legacy certificate, bundle and DSSE layers would have.
+func (s *SignatureData) setSigstoreBundle(b []byte) error {
+	var sb sigstoreBundle
+	if err := json.Unmarshal(b, &sb); err != nil {
+		return fmt.Errorf("error decoding bundle: %w", err)
+	}
+	vm := sb.VerificationMaterial
+
+	var certs [][]byte
+	switch {
+	case vm.Certificate != nil:
+		certs = append(certs, vm.Certificate.RawBytes)
+	case vm.X509CertificateChain != nil:
+		for _, c := range vm.X509CertificateChain.Certificates {
+			certs = append(certs, c.RawBytes)
+		}
+	}
+	for i, der := range certs {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return fmt.Errorf("error parsing cert: %w", err)
+		}
+		if i > 0 {
+			s.Chain = append(s.Chain, cert)
+			continue
+		}
+		s.Cert = cert
+		if s.Extensions, err = parseExtensions(cert.Extensions); err != nil {
+			return fmt.Errorf("error parsing extensions: %w", err)
+		}
+	}
+
+	// Show the Rekor entry the same way as cosign's own bundle annotation.
+	if len(vm.TlogEntries) > 0 {
+		e := vm.TlogEntries[0]
+		logIndex, err := parseProtoInt(e.LogIndex)
+		if err != nil {
+			return fmt.Errorf("error parsing log index: %w", err)
+		}
+		integrated, err := parseProtoInt(e.IntegratedTime)
+		if err != nil {
+			return fmt.Errorf("error parsing integrated time: %w", err)
+		}
+		rb := &bundle.RekorBundle{
+			Payload: bundle.RekorPayload{
+				Body:           e.CanonicalizedBody,
+				IntegratedTime: integrated,
+				LogIndex:       logIndex,
+				LogID:          hex.EncodeToString(e.LogID.KeyID),
+			},
+		}
+		if e.InclusionPromise != nil {
+			rb.SignedEntryTimestamp = e.InclusionPromise.SignedEntryTimestamp
+		}
+		s.Bundle = rb
+
+		// Rekor's own API hex encodes the hashes, so convert to its form to
+		// use its verification.
+		if p := e.InclusionProof; p != nil {
+			proofIndex, err := parseProtoInt(p.LogIndex)
+			if err != nil {
+				return fmt.Errorf("error parsing inclusion proof log index: %w", err)
+			}
+			treeSize, err := parseProtoInt(p.TreeSize)
+			if err != nil {
+				return fmt.Errorf("error parsing inclusion proof tree size: %w", err)
+			}
+			rootHash := hex.EncodeToString(p.RootHash)
+			s.InclusionProof = &models.InclusionProof{
+				LogIndex:   &proofIndex,
+				TreeSize:   &treeSize,
+				RootHash:   &rootHash,
+				Checkpoint: &p.Checkpoint.Envelope,
+			}
+			for _, h := range p.Hashes {
+				s.InclusionProof.Hashes = append(s.InclusionProof.Hashes, hex.EncodeToString(h))
+			}
+		}
+	}
+
+	if ms := sb.MessageSignature; ms != nil {
+		alg, ok := bundleHashAlgorithms[ms.MessageDigest.Algorithm]
+		if !ok {
+			alg = strings.ToLower(ms.MessageDigest.Algorithm)
+		}
+		s.MessageSignature = &messageSignature{
+			Digest:    alg + ":" + hex.EncodeToString(ms.MessageDigest.Digest),
+			Signature: ms.Signature,
+		}
+	}
+	if sb.DSSEEnvelope != nil {
+		return s.setEnvelope(sb.DSSEEnvelope)
+	}
+	return nil
+}
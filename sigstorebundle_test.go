@@ -0,0 +1,138 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+func b64(b []byte) string {
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+func TestSetSigstoreBundleDSSE(t *testing.T) {
+	leaf, _ := newTestCert(t, &x509.Certificate{EmailAddresses: []string{"me@example.com"}})
+	stmt := `{"_type":"https://in-toto.io/Statement/v1","predicateType":"https://slsa.dev/provenance/v1","subject":[{"name":"foo","digest":{"sha256":"abc"}}],"predicate":{}}`
+	// A v0.3 bundle, as cosign attest --new-bundle-format writes.
+	b := fmt.Sprintf(`{
+		"mediaType": "application/vnd.dev.sigstore.bundle.v0.3+json",
+		"verificationMaterial": {
+			"certificate": {"rawBytes": %q},
+			"tlogEntries": [{
+				"logIndex": "42",
+				"logId": {"keyId": "wNI9atQGlz+VWfO6LRygH4QUfY/8W4RFwiT5i5WRgB0="},
+				"integratedTime": "1700000000",
+				"inclusionPromise": {"signedEntryTimestamp": "MEUCIQ=="},
+				"inclusionProof": {"logIndex": "41", "rootHash": "AAAA", "treeSize": "100", "hashes": ["AQID"], "checkpoint": {"envelope": "rekor.sigstore.dev - 1\n100\n"}}
+			}]
+		},
+		"dsseEnvelope": {"payload": %q, "payloadType": "application/vnd.in-toto+json", "signatures": [{"sig": "MEUCIQ=="}]}
+	}`, b64(leaf.Raw), b64([]byte(stmt)))
+
+	s := new(SignatureData)
+	if err := s.setSigstoreBundle([]byte(b)); err != nil {
+		t.Fatal(err)
+	}
+	if s.Cert == nil || !s.Cert.Equal(leaf) {
+		t.Error("certificate wasn't parsed")
+	}
+	if s.Bundle == nil || s.Bundle.Payload.LogIndex != 42 || s.Bundle.Payload.IntegratedTime != 1700000000 {
+		t.Errorf("rekor entry: got %+v", s.Bundle)
+	}
+	if got, want := s.Bundle.Payload.LogID, "c0d23d6ad406973f9559f3ba2d1ca01f84147d8ffc5b8445c224f98b9591801d"; got != want {
+		t.Errorf("log ID: got %q, want %q", got, want)
+	}
+	if p := s.InclusionProof; p == nil || *p.LogIndex != 41 || *p.TreeSize != 100 || len(p.Hashes) != 1 || p.Hashes[0] != "010203" {
+		t.Errorf("inclusion proof: got %+v", p)
+	}
+	if s.PredicateType != "https://slsa.dev/provenance/v1" || len(s.Subjects) != 1 {
+		t.Errorf("statement: got predicate type %q and %d subjects", s.PredicateType, len(s.Subjects))
+	}
+	if s.MessageSignature != nil {
+		t.Error("DSSE bundle has a message signature")
+	}
+}
+
+func TestSetSigstoreBundleMessageSignature(t *testing.T) {
+	root, _ := newTestCert(t, &x509.Certificate{IsCA: true, BasicConstraintsValid: true})
+	leaf, _ := newTestCert(t, &x509.Certificate{EmailAddresses: []string{"me@example.com"}})
+	// A v0.2 bundle with a certificate chain, which doesn't record when the
+	// entry was integrated.
+	b := fmt.Sprintf(`{
+		"mediaType": "application/vnd.dev.sigstore.bundle+json;version=0.2",
+		"verificationMaterial": {
+			"x509CertificateChain": {"certificates": [{"rawBytes": %q}, {"rawBytes": %q}]},
+			"tlogEntries": [{"logIndex": "7", "logId": {"keyId": "AAAA"}}]
+		},
+		"messageSignature": {"messageDigest": {"algorithm": "SHA2_256", "digest": "q83v"}, "signature": "MEUCIQ=="}
+	}`, b64(leaf.Raw), b64(root.Raw))
+
+	s := new(SignatureData)
+	if err := s.setSigstoreBundle([]byte(b)); err != nil {
+		t.Fatal(err)
+	}
+	if s.Cert == nil || !s.Cert.Equal(leaf) || len(s.Chain) != 1 || !s.Chain[0].Equal(root) {
+		t.Error("certificate chain wasn't parsed")
+	}
+	if s.Bundle == nil || s.Bundle.Payload.LogIndex != 7 || s.Bundle.Payload.IntegratedTime != 0 {
+		t.Errorf("rekor entry: got %+v", s.Bundle)
+	}
+	if ms := s.MessageSignature; ms == nil || ms.Digest != "sha256:abcdef" {
+		t.Errorf("message signature: got %+v", ms)
+	}
+	if s.Envelope != nil {
+		t.Error("message signature bundle has an envelope")
+	}
+}
+
+func TestSetSigstoreBundleMalformed(t *testing.T) {
+	for _, b := range []string{
+		`not json`,
+		`{"verificationMaterial": {"certificate": {"rawBytes": "AAAA"}}}`,
+		`{"verificationMaterial": {"tlogEntries": [{"logIndex": "forty-two"}]}}`,
+	} {
+		if err := new(SignatureData).setSigstoreBundle([]byte(b)); err == nil {
+			t.Errorf("%s: want an error", b)
+		}
+	}
+}
+
+func TestGetDataSigstoreBundle(t *testing.T) {
+	repo := newTestRepo(t)
+	d := pushImage(t, repo.Tag("latest"))
+	b := `{"mediaType": "application/vnd.dev.sigstore.bundle.v0.3+json", "verificationMaterial": {}, "messageSignature": {"messageDigest": {"algorithm": "SHA2_256", "digest": "q83v"}, "signature": "MEUCIQ=="}}`
+	layer := mutate.Addendum{Layer: static.NewLayer([]byte(b), types.MediaType("application/vnd.dev.sigstore.bundle.v0.3+json"))}
+	pushManifest(t, repo.Tag("bundle"), referrer(t, artifact(t, layer), d))
+
+	out, err := handleRef(context.Background(), d, lookupOptions{discovery: discoveryReferrers})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !out.Verdict.Signed {
+		t.Error("a message signature bundle doesn't count as signed")
+	}
+	if md := renderTemplate(t, out); !strings.Contains(md, "sha256:abcdef") {
+		t.Errorf("signed digest isn't shown:\n%s", md)
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// maxSLSALevel is the highest SLSA v1.0 build level.
+const maxSLSALevel = 3
+
+// We can't see how a build actually ran, only what its provenance claims, so
+// the levels are judged by who the builder is:
+//
+//   - Build L1: there is SLSA provenance.
+//   - Build L2: the provenance is signed, and the builder is a hosted build
+//     platform (hostedBuilders, or a Fulcio certificate saying the signer
+//     ran on a forge-hosted runner).
+//   - Build L3: the builder is one known to isolate builds from each other
+//     and keep signing keys out of reach of the build (hardenedBuilders).
+//
+// All of that is self-declared by the attestation and its certificate, so L2
+// and above are only granted once the attestation's signature has been
+// verified (verify=true). Until then they're only claimed.
+var (
+	hostedBuilders = []string{
+		"https://github.com/actions/runner/github-hosted",
+		"https://github.com/slsa-framework/slsa-github-generator/",
+		"https://cloudbuild.googleapis.com/",
+	}
+	hardenedBuilders = []string{
+		"https://github.com/slsa-framework/slsa-github-generator/",
+		"https://cloudbuild.googleapis.com/GoogleHostedWorker",
+	}
+)
+
+// slsaResult is the SLSA build level an image's provenance achieves.
+type slsaResult struct {
+	Level int `json:"level"`
+	// Reasons explain how each level was (or wasn't) reached.
+	Reasons []string `json:"reasons"`
+	// Required is the level that was asked for, if any.
+	Required *int `json:"required,omitempty"`
+	// Claimed is the level the provenance claims, if it's higher than Level
+	// but couldn't be granted because the attestation wasn't verified.
+	Claimed int `json:"claimed,omitempty"`
+}
+
+// Pass reports whether the required level, if any, was reached.
+func (r *slsaResult) Pass() bool {
+	return r.Required == nil || r.Level >= *r.Required
+}
+
+// slsaLevel evaluates the SLSA build level of a single provenance
+// attestation.
+func slsaLevel(s *SignatureData) *slsaResult {
+	return claimedOnly(claimedLevel(s), s)
+}
+
+// claimedLevel is the SLSA build level s's provenance would reach, taking its
+// builder and certificate at their word.
+func claimedLevel(s *SignatureData) *slsaResult {
+	p := s.Provenance
+	if p == nil {
+		return &slsaResult{Reasons: []string{"L1: no SLSA provenance"}}
+	}
+	r := &slsaResult{Level: 1, Reasons: []string{"L1: SLSA provenance from " + p.BuilderID}}
+
+	// cosign attestations are always signed, but with a key there's nothing
+	// tying the signature to the builder.
+	if s.Cert == nil {
+		r.Reasons = append(r.Reasons, "L2: provenance isn't signed by a Fulcio identity")
+		return r
+	}
+	hosted := hasPrefix(hostedBuilders, p.BuilderID)
+	if !hosted && slices.Contains(hostedRunners, s.Extensions.RunnerEnvironment) {
+		hosted = true
+	}
+	if !hosted {
+		r.Reasons = append(r.Reasons, "L2: "+p.BuilderID+" isn't a known hosted build platform")
+		return r
+	}
+	r.Level = 2
+	r.Reasons = append(r.Reasons, "L2: signed provenance from a hosted build platform")
+
+	if !hasPrefix(hardenedBuilders, p.BuilderID) {
+		r.Reasons = append(r.Reasons, "L3: "+p.BuilderID+" isn't a known hardened builder")
+		return r
+	}
+	r.Level = 3
+	r.Reasons = append(r.Reasons, "L3: built by a hardened builder")
+	return r
+}
+
+// claimedOnly caps r at L1 unless s's signature was verified, since nothing
+// above that can be trusted otherwise.
+func claimedOnly(r *slsaResult, s *SignatureData) *slsaResult {
+	if r.Level < 2 || (s.Verification != nil && s.Verification.OK) {
+		return r
+	}
+	r.Claimed, r.Level = r.Level, 1
+	if s.Verification == nil {
+		r.Reasons = append(r.Reasons, fmt.Sprintf("L%d is only claimed: the attestation wasn't verified (verify=true)", r.Claimed))
+	} else {
+		r.Reasons = append(r.Reasons, fmt.Sprintf("L%d is only claimed: the attestation didn't verify: %s", r.Claimed, s.Verification.Error))
+	}
+	return r
+}
+
+// bestSLSALevel returns the highest level achieved by any of out's
+// attestations, or nil if there's no provenance at all.
+func bestSLSALevel(out *output) *slsaResult {
+	var best *slsaResult
+	for _, g := range out.Groups {
+		for _, m := range g.Data {
+			for _, s := range m.Data {
+				if s.Provenance == nil {
+					continue
+				}
+				r := slsaLevel(s)
+				if best == nil || r.Level > best.Level || (r.Level == best.Level && r.Claimed > best.Claimed) {
+					best = r
+				}
+			}
+		}
+	}
+	return best
+}
+
+func hasPrefix(prefixes []string, s string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const generatorBuilder = "https://github.com/slsa-framework/slsa-github-generator/.github/workflows/generator_container_slsa3.yml@refs/tags/v1.9.0"
+
+func TestSLSALevel(t *testing.T) {
+	cert, _ := newTestCert(t, &x509.Certificate{})
+	hosted := &provenanceSummary{BuilderID: "https://github.com/actions/runner/github-hosted"}
+	hardened := &provenanceSummary{BuilderID: generatorBuilder}
+	ok := &verification{OK: true}
+	failed := &verification{Error: "signature did not verify"}
+	for _, tc := range []struct {
+		name          string
+		s             *SignatureData
+		level, claims int
+	}{
+		{"no provenance", &SignatureData{}, 0, 0},
+		{"signed with a key", &SignatureData{Provenance: hardened, Verification: ok}, 1, 0},
+		{"hosted, verified", &SignatureData{Provenance: hosted, Cert: cert, Verification: ok}, 2, 0},
+		{"hosted, unverified", &SignatureData{Provenance: hosted, Cert: cert}, 1, 2},
+		{"hardened, verified", &SignatureData{Provenance: hardened, Cert: cert, Verification: ok}, 3, 0},
+		{"hardened, unverified", &SignatureData{Provenance: hardened, Cert: cert}, 1, 3},
+		{"hardened, failed verification", &SignatureData{Provenance: hardened, Cert: cert, Verification: failed}, 1, 3},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := slsaLevel(tc.s)
+			if r.Level != tc.level || r.Claimed != tc.claims {
+				t.Errorf("got L%d claiming L%d, want L%d claiming L%d: %q", r.Level, r.Claimed, tc.level, tc.claims, r.Reasons)
+			}
+			three := 3
+			r.Required = &three
+			if r.Pass() != (tc.level == 3) {
+				t.Errorf("Pass for L3: got %v", r.Pass())
+			}
+		})
+	}
+}
+
+func TestResolveSLSAStrictForged(t *testing.T) {
+	repo := newTestRepo(t)
+	d := pushImage(t, repo.Tag("latest"))
+	// Anyone can self-sign a certificate and claim a hardened builder.
+	_, cert := newTestCert(t, &x509.Certificate{})
+	predicate := fmt.Sprintf(`{"builder":{"id":%q},"buildType":"https://github.com/slsa-framework/slsa-github-generator/container@v1"}`, generatorBuilder)
+	att := attestationLayer(t, d, "https://slsa.dev/provenance/v0.2", predicate, map[string]string{"dev.sigstore.cosign/certificate": cert})
+	pushManifest(t, cosignTag(d, "att"), artifact(t, att))
+
+	out, code, err := resolve(t, newTestServer(), d.String(), url.Values{"slsa": {"3"}, "strict": {"true"}})
+	if code != http.StatusPreconditionFailed {
+		t.Fatalf("status: got %d (%v), want %d", code, err, http.StatusPreconditionFailed)
+	}
+	if out.SLSA == nil || out.SLSA.Level != 1 || out.SLSA.Claimed != 3 {
+		t.Errorf("got %+v, want L1 claiming L3", out.SLSA)
+	}
+	if md := renderTemplate(t, out); !strings.Contains(md, "claims L3, unverified") {
+		t.Errorf("page doesn't say L3 is only claimed:\n%s", md)
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+var errPrivateAddress = errors.New("registry is on a private address")
+
+// sharedAddressSpace is 100.64.0.0/10 (RFC 6598), which some clouds serve
+// their metadata endpoints from.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// isPrivateAddr reports whether a is somewhere a public server has no
+// business connecting to on a user's behalf: loopback, private, link-local
+// (e.g. the 169.254.169.254 metadata endpoint) and the like.
+func isPrivateAddr(a netip.Addr) bool {
+	a = a.Unmap()
+	return a.IsLoopback() || a.IsPrivate() || a.IsUnspecified() ||
+		a.IsLinkLocalUnicast() || a.IsLinkLocalMulticast() || a.IsInterfaceLocalMulticast() ||
+		sharedAddressSpace.Contains(a)
+}
+
+// publicOnlyTransport returns a copy of t that refuses to connect to private
+// addresses, since the registries it talks to are picked by whoever's making
+// the request. The check is made on the address actually dialed, after DNS
+// resolution, so a hostname can't be pointed (or rebound) at an internal
+// service. Proxies are dialed through it too.
+func publicOnlyTransport(t *http.Transport) *http.Transport {
+	t = t.Clone()
+	d := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			ap, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return fmt.Errorf("unexpected dial address %s: %w", address, err)
+			}
+			if isPrivateAddr(ap.Addr()) {
+				return fmt.Errorf("%w: %s", errPrivateAddress, ap.Addr())
+			}
+			return nil
+		},
+	}
+	t.DialContext = d.DialContext
+	return t
+}
@@ -0,0 +1,76 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/netip"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+func TestIsPrivateAddr(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"127.0.0.1":        true,
+		"::1":              true,
+		"10.1.2.3":         true,
+		"172.16.0.1":       true,
+		"192.168.1.1":      true,
+		"169.254.169.254":  true,
+		"100.100.100.200":  true,
+		"0.0.0.0":          true,
+		"fe80::1":          true,
+		"fd00::1":          true,
+		"::ffff:127.0.0.1": true,
+		"8.8.8.8":          false,
+		"140.82.112.33":    false,
+		"2606:4700::1111":  false,
+		"100.128.0.1":      false,
+	} {
+		if got := isPrivateAddr(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("isPrivateAddr(%s): got %v, want %v", addr, got, want)
+		}
+	}
+}
+
+func TestPublicOnlyTransport(t *testing.T) {
+	host := newTestRegistry(t)
+	c := &http.Client{Transport: publicOnlyTransport(remote.DefaultTransport.(*http.Transport))}
+	for _, u := range []string{
+		"http://" + host + "/v2/",
+		// The metadata endpoint is refused before anything is sent to it.
+		"http://169.254.169.254/latest/meta-data/",
+	} {
+		resp, err := c.Get(u)
+		if err == nil {
+			resp.Body.Close()
+		}
+		if !errors.Is(err, errPrivateAddress) {
+			t.Errorf("GET %s: got %v, want %v", u, err, errPrivateAddress)
+		}
+	}
+}
+
+func TestResolvePrivateRegistry(t *testing.T) {
+	repo := newTestRepo(t)
+	d := pushImage(t, repo.Tag("latest"))
+	s := newTestServer()
+	s.transport = publicOnlyTransport(remote.DefaultTransport.(*http.Transport))
+	if _, code, err := resolve(t, s, d.String(), nil); code != http.StatusForbidden || !errors.Is(err, errPrivateAddress) {
+		t.Errorf("got %d (%v), want %d", code, err, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"time"
+
+	ctypes "github.com/sigstore/cosign/v2/pkg/types"
+)
+
+// summarySchema identifies the version of the summary format. Bump it on any
+// incompatible change so that ingestion pipelines can tell records apart.
+const summarySchema = "https://oci.fyi/summary/v1"
+
+// summary is a flattened view of output for bulk ingestion into provenance
+// datastores, served by /api/v1/summary. Unlike apiOutput, it only carries
+// who signed/attested what, not how it's stored.
+type summary struct {
+	Schema       string               `json:"schema"`
+	Image        string               `json:"image"`
+	Digest       string               `json:"digest"`
+	GeneratedAt  time.Time            `json:"generatedAt"`
+	Signatures   []summarySignature   `json:"signatures"`
+	Attestations []summaryAttestation `json:"attestations"`
+}
+
+// summarySigner identifies who produced a signature or attestation.
+type summarySigner struct {
+	// Platform is set if the entry is attached to a platform of an index,
+	// rather than the requested image itself.
+	Platform string   `json:"platform,omitempty"`
+	Identity []string `json:"identity,omitempty"`
+	Issuer   string   `json:"issuer,omitempty"`
+	// RekorLogIndex is the transparency log entry, if the signature was
+	// uploaded to Rekor.
+	RekorLogIndex *int64 `json:"rekorLogIndex,omitempty"`
+}
+
+type summarySignature struct {
+	summarySigner
+	Layer string `json:"layer"`
+}
+
+type summaryAttestation struct {
+	summarySigner
+	Layer         string           `json:"layer"`
+	PredicateType string           `json:"predicateType"`
+	Subjects      []summarySubject `json:"subjects,omitempty"`
+}
+
+type summarySubject struct {
+	Name   string `json:"name"`
+	Digest string `json:"digest"`
+}
+
+func toSummary(out *output, now time.Time) *summary {
+	s := &summary{
+		Schema:       summarySchema,
+		Image:        out.Ref.String(),
+		Digest:       out.ResolvedRef.Identifier(),
+		GeneratedAt:  now.UTC(),
+		Signatures:   []summarySignature{},
+		Attestations: []summaryAttestation{},
+	}
+	for _, g := range out.Groups {
+		for _, m := range g.Data {
+			for _, d := range m.Data {
+				signer := summarySigner{
+					Platform: g.Platform,
+					Identity: sans(d.Cert),
+					Issuer:   d.Extensions.Issuer,
+				}
+				if d.Bundle != nil {
+					signer.RekorLogIndex = &d.Bundle.Payload.LogIndex
+				}
+
+				switch {
+				case d.PredicateType != "":
+					a := summaryAttestation{
+						summarySigner: signer,
+						Layer:         d.Layer.String(),
+						PredicateType: d.PredicateType,
+					}
+					for _, sub := range d.Subjects {
+						a.Subjects = append(a.Subjects, summarySubject{Name: sub.Name, Digest: formatDigest(sub.Digest)})
+					}
+					s.Attestations = append(s.Attestations, a)
+				case d.DigestMismatch:
+					// A signature copied from another image says nothing
+					// about this one.
+				case d.LayerType == ctypes.SimpleSigningMediaType, d.Notation != nil, d.MessageSignature != nil:
+					s.Signatures = append(s.Signatures, summarySignature{
+						summarySigner: signer,
+						Layer:         d.Layer.String(),
+					})
+				}
+			}
+		}
+	}
+	return s
+}
+
+// verdict answers the question most people look an image up for: is it
+// signed, is it attested, and by whom.
+type verdict struct {
+	Signed   bool
+	Attested bool
+	// Signers is the number of distinct identities across all signatures
+	// and attestations. Key-based signatures, which have no identity, aren't
+	// counted.
+	Signers int
+	// Issuer is the OIDC issuer used by the most signatures and
+	// attestations, if any.
+	Issuer string
+}
+
+// verdictOf builds the verdict on out from the same signatures and
+// attestations as its summary, so it agrees with the badge.
+func verdictOf(out *output) *verdict {
+	sum := toSummary(out, time.Time{})
+	v := &verdict{Signed: len(sum.Signatures) > 0, Attested: len(sum.Attestations) > 0}
+	identities := map[string]bool{}
+	issuers := map[string]int{}
+	add := func(s summarySigner) {
+		if len(s.Identity) > 0 {
+			identities[strings.Join(s.Identity, ", ")] = true
+		}
+		if s.Issuer != "" {
+			issuers[s.Issuer]++
+		}
+	}
+	for _, s := range sum.Signatures {
+		add(s.summarySigner)
+	}
+	for _, a := range sum.Attestations {
+		add(a.summarySigner)
+	}
+	v.Signers = len(identities)
+	for iss, n := range issuers {
+		// Break ties alphabetically so the verdict doesn't flap between
+		// renders.
+		if n > issuers[v.Issuer] || (n == issuers[v.Issuer] && iss < v.Issuer) {
+			v.Issuer = iss
+		}
+	}
+	return v
+}
@@ -0,0 +1,199 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	slsa02 "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/v0.2"
+	slsa1 "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/v1"
+)
+
+// Tekton Chains build types. The slsa/v1 format produces SLSA v0.2
+// provenance typed by the kind of run, e.g. tekton.dev/v1beta1/TaskRun. The
+// slsa/v2alphaN formats produce SLSA v1.0 provenance with one of the
+// build types under tektonBuildTypeV2.
+const (
+	tektonBuildTypeV1 = "tekton.dev/"
+	tektonBuildTypeV2 = "https://tekton.dev/chains/v2/"
+)
+
+// tektonSummary is the pipeline or task run a Tekton Chains provenance
+// attestation describes.
+type tektonSummary struct {
+	// Kind is TaskRun or PipelineRun, if known.
+	Kind string
+	// Pipeline and Task are the names of what was run, if known.
+	Pipeline string
+	Task     string
+	// InvocationID identifies the run (its Kubernetes UID).
+	InvocationID string
+	// Tasks are the tasks of a PipelineRun.
+	Tasks []tektonTask
+	// Results are the results of the run itself.
+	Results []tektonResult
+}
+
+type tektonTask struct {
+	Name string
+	// Ref is the name of the Task the pipeline task ran.
+	Ref     string
+	Status  string
+	Results []tektonResult
+}
+
+type tektonResult struct {
+	Name  string
+	Value string
+}
+
+func (r tektonResult) String() string {
+	return r.Name + "=" + r.Value
+}
+
+// parseTektonChains summarizes an in-toto statement produced by Tekton
+// Chains. If the statement isn't Tekton provenance, nil is returned.
+func parseTektonChains(body []byte) (*tektonSummary, error) {
+	var stmt struct {
+		PredicateType string          `json:"predicateType"`
+		Predicate     json.RawMessage `json:"predicate"`
+	}
+	if err := json.Unmarshal(body, &stmt); err != nil {
+		return nil, fmt.Errorf("error decoding statement: %w", err)
+	}
+
+	switch stmt.PredicateType {
+	case slsa02.PredicateSLSAProvenance:
+		var p struct {
+			BuildType  string `json:"buildType"`
+			Invocation struct {
+				Environment struct {
+					Labels map[string]string `json:"labels"`
+				} `json:"environment"`
+			} `json:"invocation"`
+			BuildConfig struct {
+				Tasks []struct {
+					Name string `json:"name"`
+					Ref  struct {
+						Name string `json:"name"`
+					} `json:"ref"`
+					Status  string `json:"status"`
+					Results []struct {
+						Name  string          `json:"name"`
+						Value json.RawMessage `json:"value"`
+					} `json:"results"`
+				} `json:"tasks"`
+			} `json:"buildConfig"`
+			Metadata struct {
+				BuildInvocationID string `json:"buildInvocationID"`
+			} `json:"metadata"`
+		}
+		if err := json.Unmarshal(stmt.Predicate, &p); err != nil {
+			return nil, fmt.Errorf("error decoding provenance: %w", err)
+		}
+		if !strings.HasPrefix(p.BuildType, tektonBuildTypeV1) {
+			return nil, nil
+		}
+		labels := p.Invocation.Environment.Labels
+		out := &tektonSummary{
+			Kind:         p.BuildType[strings.LastIndex(p.BuildType, "/")+1:],
+			Pipeline:     labels["tekton.dev/pipeline"],
+			Task:         labels["tekton.dev/task"],
+			InvocationID: p.Metadata.BuildInvocationID,
+		}
+		for _, t := range p.BuildConfig.Tasks {
+			task := tektonTask{Name: t.Name, Ref: t.Ref.Name, Status: t.Status}
+			for _, r := range t.Results {
+				task.Results = append(task.Results, tektonResult{Name: r.Name, Value: resultValue(r.Value)})
+			}
+			out.Tasks = append(out.Tasks, task)
+		}
+		return out, nil
+
+	case slsa1.PredicateSLSAProvenance:
+		var p struct {
+			BuildDefinition struct {
+				BuildType          string `json:"buildType"`
+				ExternalParameters struct {
+					RunSpec struct {
+						PipelineRef struct {
+							Name string `json:"name"`
+						} `json:"pipelineRef"`
+						TaskRef struct {
+							Name string `json:"name"`
+						} `json:"taskRef"`
+					} `json:"runSpec"`
+				} `json:"externalParameters"`
+			} `json:"buildDefinition"`
+			RunDetails struct {
+				Metadata struct {
+					InvocationID string `json:"invocationID"`
+				} `json:"metadata"`
+				Byproducts []struct {
+					Name    string `json:"name"`
+					Content []byte `json:"content"`
+				} `json:"byproducts"`
+			} `json:"runDetails"`
+		}
+		if err := json.Unmarshal(stmt.Predicate, &p); err != nil {
+			return nil, fmt.Errorf("error decoding provenance: %w", err)
+		}
+		if !strings.HasPrefix(p.BuildDefinition.BuildType, tektonBuildTypeV2) {
+			return nil, nil
+		}
+		spec := p.BuildDefinition.ExternalParameters.RunSpec
+		out := &tektonSummary{
+			Pipeline:     spec.PipelineRef.Name,
+			Task:         spec.TaskRef.Name,
+			InvocationID: p.RunDetails.Metadata.InvocationID,
+		}
+		switch {
+		case out.Pipeline != "":
+			out.Kind = "PipelineRun"
+		case out.Task != "":
+			out.Kind = "TaskRun"
+		}
+		// Run results are recorded as byproducts named after where they
+		// came from, e.g. pipelineRunResults/IMAGE_DIGEST.
+		for _, b := range p.RunDetails.Byproducts {
+			_, name, ok := strings.Cut(b.Name, "RunResults/")
+			if !ok {
+				continue
+			}
+			out.Results = append(out.Results, tektonResult{Name: name, Value: resultValue(b.Content)})
+		}
+		sort.Slice(out.Results, func(i, j int) bool { return out.Results[i].Name < out.Results[j].Name })
+		return out, nil
+	}
+	return nil, nil
+}
+
+// resultValue renders a Tekton result, which may be a string, array or
+// object.
+func resultValue(v json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(v, &s); err == nil {
+		return s
+	}
+	var b bytes.Buffer
+	if err := json.Compact(&b, v); err != nil {
+		return string(v)
+	}
+	return b.String()
+}
@@ -15,98 +15,637 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"embed"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"html/template"
+	"net/url"
 	"strings"
 	"time"
 
 	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
 	ociremote "github.com/sigstore/cosign/v2/pkg/oci/remote"
 	"github.com/sigstore/fulcio/pkg/certificate"
 )
 
 type output struct {
+	// Input is the image as given by the user, after normalizeImage.
+	Input       string
 	Ref         name.Reference
 	ResolvedRef name.Reference
+	// CLI is set when rendering for the terminal rather than the web.
+	CLI bool
+	// Raw enables rendering of the raw underlying data (e.g. DSSE envelopes).
+	Raw bool
+	// Partial is set if the lookup gave up early because it hit its request
+	// budget.
+	Partial bool
+	// Expected is the digest the caller expected ResolvedRef to have, if any.
+	Expected string
+	// Match reports whether ResolvedRef matches Expected.
+	Match bool
+	// Policy is the result of checking for required attestations, if any
+	// were requested.
+	Policy *policyResult
+	// SLSA is the best SLSA build level of the image's provenance, if it
+	// has any or a level was required.
+	SLSA *slsaResult
+	// History is the digests Ref has been seen to resolve to, most recent
+	// first. Only set if Ref is a tag.
+	History []tagObservation
+	// Metadata is what the image's config labels say about its source, if
+	// requested.
+	Metadata *imageMetadata
+	// Tags are the tags found to point at the image (or IndexRef), if the
+	// server lists tags.
+	Tags []string
+	// LastSigned is the newest Rekor integrated time of any signature, if any
+	// were timestamped.
+	LastSigned time.Time
+	// Stale is set if LastSigned is older than the server's staleness
+	// threshold.
+	Stale bool
+	// Permalink links to these results by digest rather than tag, so that
+	// they don't change as the tag moves. Only set if Ref is a tag.
+	Permalink string
+	// Platform is the platform of IndexRef that ResolvedRef was pinned to,
+	// if the caller asked for one.
+	Platform string
+	IndexRef name.Reference
+	// Index is set if ResolvedRef is an image index.
+	Index bool
+	// Verdict is whether the image is signed and attested, and by whom.
+	Verdict *verdict
+	// Page is the window of each manifest's entries to show, if they're
+	// paged.
+	Page *page
+	// Groups are the manifests attached to each image. For an index, the
+	// first group is the index itself, followed by a group per platform.
+	Groups []*group
+}
+
+// group is the set of manifests attached to a single image.
+type group struct {
+	// Platform is set if this group belongs to a child of an index. For
+	// children that aren't platform images, it's their label instead (see
+	// childLabel), and Artifact is set.
+	Platform string
+	Artifact bool
+	Ref      name.Digest
+	// Annotations and Subject are those of the index itself, and so are
+	// only set on an index's group.
+	Annotations map[string]string
+	Subject     *v1.Descriptor
 	Data        []*manifest
+	// ReferrersIndex is the referrers index the registry returned for Ref,
+	// if referrers were looked up.
+	ReferrersIndex []byte
 }
 
 type manifest struct {
-	Name   string
-	Digest string
-	Data   []*SignatureData
+	Name      string
+	Digest    string
+	MediaType string
+	// ArtifactType is set for manifests discovered via the referrers API.
+	ArtifactType string
+	// Error is set if the manifest couldn't be (fully) fetched. A manifest
+	// that doesn't exist is not an error.
+	Error string
+	// Manifest is the raw manifest JSON, served by raw=manifest.
+	Manifest []byte
+	Data     []*SignatureData
+}
+
+// UnknownMediaType reports whether the manifest has a media type other than
+// the standard OCI/Docker image manifest or index types.
+func (m *manifest) UnknownMediaType() bool {
+	switch types.MediaType(m.MediaType) {
+	case "", types.OCIManifestSchema1, types.DockerManifestSchema2, types.OCIImageIndex, types.DockerManifestList:
+		return false
+	}
+	return true
 }
 
 var (
-	//go:embed "template.md"
-	fs   embed.FS
-	tmpl = template.Must(
+	//go:embed "template.md" "compare.md" "error.md"
+	fs embed.FS
+	//go:embed "favicon.svg"
+	favicon []byte
+	tmpl    = template.Must(
 		template.New("").
 			Funcs(template.FuncMap{
-				"unix":           func(t int64) time.Time { return time.Unix(t, 0) },
-				"shaURL":         shaURL,
-				"buildConfigURL": buildConfigURL,
-				"issuerIcon":     issuerIcon,
-				"subjectAltName": subjectAltName,
-				"lower":          strings.ToLower,
+				"unix":             unixTime,
+				"relTime":          relTime,
+				"ago":              ago,
+				"rekorURL":         rekorURL,
+				"runURL":           runURL,
+				"signerGroups":     signerGroupsOf,
+				"shaURL":           shaURL,
+				"sourceRepo":       sourceRepo,
+				"sourceCommit":     sourceCommit,
+				"sourceRef":        sourceRef,
+				"workflowRepo":     workflowRepo,
+				"isSigstoreBundle": isSigstoreBundle,
+				"sourceURL":        sourceURL,
+				"buildConfigURL":   buildConfigURL,
+				"issuer":           issuer,
+				"subjectAltName":   subjectAltName,
+				"lower":            strings.ToLower,
+				"toJSON":           toJSON,
+				"certKeyInfo":      certKeyInfo,
+				"certPEM":          certPEM,
+				"certValidity":     certValidity,
+				"certChain":        certChain,
+				"signedInWindow":   signedWhileValid,
+				"certDownload":     certDownloadURL,
+				"sbomFormat":       sbomFormat,
+				"trust":            trustSummaryOf,
+				"digestMismatch":   hasDigestMismatch,
+				"sourceMismatch":   sourceMismatches,
+				"pinned":           pinnedRef,
+				"platforms":        platforms,
+				"signers":          signersOf,
+				"page":             pageOf,
 			}).
-			ParseFS(fs, "template.md"),
+			ParseFS(fs, "template.md", "compare.md", "error.md"),
 	)
 )
 
+// rekorURL links to the Rekor search UI for a log entry. Index 0 is what we
+// get when the bundle didn't record one, so no link is produced for it.
+func rekorURL(logIndex int64) string {
+	if logIndex <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("https://search.sigstore.dev/?logIndex=%d", logIndex)
+}
+
+// lastSigned returns the newest Rekor integrated time across all of out's
+// signatures and attestations, or the zero time if none have one.
+func lastSigned(out *output) time.Time {
+	var newest int64
+	for _, g := range out.Groups {
+		for _, m := range g.Data {
+			for _, s := range m.Data {
+				if s.Bundle != nil && s.Bundle.Payload.IntegratedTime > newest {
+					newest = s.Bundle.Payload.IntegratedTime
+				}
+			}
+		}
+	}
+	if newest == 0 {
+		return time.Time{}
+	}
+	return time.Unix(newest, 0).UTC()
+}
+
+// platforms lists the platforms of out's index, in index order.
+func platforms(out *output) []string {
+	var ps []string
+	for _, g := range out.Groups {
+		if g.Platform != "" && !g.Artifact {
+			ps = append(ps, g.Platform)
+		}
+	}
+	return ps
+}
+
+// hasDigestMismatch reports whether any signature in out claims to cover a
+// different image than the one it's attached to.
+func hasDigestMismatch(out *output) bool {
+	for _, g := range out.Groups {
+		for _, m := range g.Data {
+			for _, s := range m.Data {
+				if s.DigestMismatch {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// pinnedRef returns the tag out was looked up by, pinned to the digest it
+// resolved to (e.g. repo:tag@sha256:...), or "" if it was looked up by
+// digest. With a platform, the tag points at the index, so that's what it's
+// pinned to.
+func pinnedRef(out *output) string {
+	t, ok := out.Ref.(name.Tag)
+	if !ok {
+		return ""
+	}
+	d := out.ResolvedRef
+	if out.IndexRef != nil {
+		d = out.IndexRef
+	}
+	return t.Name() + "@" + d.Identifier()
+}
+
+// timeLayout is how absolute times are displayed.
+const timeLayout = "2006-01-02 15:04:05 MST"
+
+// ago describes how long ago t was, e.g. "3 days ago", or how long until it
+// is for times in the future, e.g. "in 3 days".
+func ago(t time.Time) string {
+	d := time.Since(t)
+	switch {
+	case d < 0:
+		return "in " + roughDuration(-d)
+	case d < 2*time.Minute:
+		return "just now"
+	}
+	return roughDuration(d) + " ago"
+}
+
+// roughDuration rounds d down to the largest sensible unit, e.g. "3 days".
+func roughDuration(d time.Duration) string {
+	switch {
+	case d < 2*time.Minute:
+		return fmt.Sprintf("%d seconds", int(d.Seconds()))
+	case d < 2*time.Hour:
+		return fmt.Sprintf("%d minutes", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%d hours", int(d.Hours()))
+	}
+	return fmt.Sprintf("%d days", int(d.Hours()/24))
+}
+
+// relTime renders t relative to now, with the absolute time as a tooltip.
+func relTime(t time.Time) template.HTML {
+	if t.IsZero() {
+		return ""
+	}
+	return template.HTML(fmt.Sprintf(`<span title="%s">%s</span>`, template.HTMLEscapeString(t.UTC().Format(timeLayout)), template.HTMLEscapeString(ago(t))))
+}
+
+// unixTime converts a Rekor integrated time (seconds since the epoch) to a
+// time.Time. Zero means the bundle didn't record one.
+func unixTime(t int64) time.Time {
+	if t <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(t, 0).UTC()
+}
+
+// forge describes the URL layout of a source forge.
+type forge struct {
+	// commit is the format of a commit URL, given the repo and SHA.
+	commit string
+	// blob is the format of a file URL, given the repo, SHA and path.
+	blob string
+	// sep, if set, separates the repository from the path of a file in
+	// build config URIs.
+	sep string
+}
+
+var (
+	forgeGitHub = forge{commit: "%s/commit/%s", blob: "%s/blob/%s/%s"}
+	// GitLab separates the project from the file with "//", since projects
+	// can be nested in arbitrarily deep groups.
+	forgeGitLab    = forge{commit: "%s/-/commit/%s", blob: "%s/-/blob/%s/%s", sep: "//"}
+	forgeBitbucket = forge{commit: "%s/commits/%s", blob: "%s/src/%s/%s"}
+	forgeGitea     = forge{commit: "%s/commit/%s", blob: "%s/src/commit/%s/%s"}
+)
+
+// githubEnterpriseHosts are the GitHub Enterprise Server hosts to link to
+// like github.com. GHES can run on any host, so they have to be configured.
+var githubEnterpriseHosts = map[string]bool{}
+
+// forgeOf guesses which forge hosts the given repository URI.
+func forgeOf(uri string) (forge, bool) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return forge{}, false
+	}
+	host := strings.ToLower(u.Hostname())
+	switch {
+	case host == "github.com" || githubEnterpriseHosts[host]:
+		return forgeGitHub, true
+	case host == "gitlab.com" || strings.HasPrefix(host, "gitlab."):
+		return forgeGitLab, true
+	case host == "bitbucket.org":
+		return forgeBitbucket, true
+	case host == "codeberg.org" || host == "gitea.com" ||
+		strings.HasPrefix(host, "gitea.") || strings.HasPrefix(host, "forgejo."):
+		return forgeGitea, true
+	}
+	return forge{}, false
+}
+
+// runURL returns the run invocation URI of a certificate if it's safe to
+// link to, i.e. it's a web URL.
+func runURL(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return ""
+	}
+	return uri
+}
+
+// shaURL links to a commit in the given repository, for the forges we know
+// the URL scheme of. Otherwise, the repository itself is linked.
 func shaURL(repo, sha string) string {
-	if strings.HasPrefix(repo, "https://github.com") {
-		return fmt.Sprintf("%s/commit/%s", repo, sha)
+	f, ok := forgeOf(repo)
+	if !ok || sha == "" {
+		return repo
+	}
+	return fmt.Sprintf(f.commit, strings.TrimSuffix(repo, "/"), sha)
+}
+
+// sourceURL links to the source a SLSA provenance build was invoked from,
+// given as a URI like git+https://github.com/foo/bar@refs/heads/main and a
+// digest like sha1:<commit>. If the source isn't on a forge we know, "" is
+// returned.
+func sourceURL(p *provenanceSummary) string {
+	repo, _, _ := strings.Cut(strings.TrimPrefix(p.Source, "git+"), "@")
+	repo = strings.TrimSuffix(repo, ".git")
+	if _, ok := forgeOf(repo); !ok {
+		return ""
+	}
+	var sha string
+	if alg, v, ok := strings.Cut(p.SourceDigest, ":"); ok && (alg == "sha1" || alg == "gitCommit") {
+		sha = v
+	}
+	return shaURL(repo, sha)
+}
+
+// The deprecated GitHub-specific extensions only ever described GitHub
+// Actions builds, so they're used as a fallback when the V2 extensions aren't
+// present.
+
+// sourceRepo returns the URL of the repository that was built.
+func sourceRepo(ext certificate.Extensions) string {
+	if ext.SourceRepositoryURI != "" {
+		return ext.SourceRepositoryURI
+	}
+	if ext.GithubWorkflowRepository != "" {
+		return "https://github.com/" + ext.GithubWorkflowRepository
+	}
+	return ""
+}
+
+// sourceCommit returns the commit of the source repository that was built.
+func sourceCommit(ext certificate.Extensions) string {
+	if ext.SourceRepositoryDigest != "" {
+		return ext.SourceRepositoryDigest
+	}
+	return ext.GithubWorkflowSHA
+}
+
+// sourceRef returns the git ref that was built.
+func sourceRef(ext certificate.Extensions) string {
+	if ext.SourceRepositoryRef != "" {
+		return ext.SourceRepositoryRef
+	}
+	return ext.GithubWorkflowRef
+}
+
+// workflowRepo returns the repository the build config (e.g. the workflow
+// file) lives in, which BuildConfigDigest is a commit of. This differs from
+// the source repository when a reusable workflow from elsewhere did the
+// build.
+func workflowRepo(ext certificate.Extensions) string {
+	uri, _, _ := strings.Cut(ext.BuildConfigURI, "@")
+	f, ok := forgeOf(uri)
+	if !ok {
+		return sourceRepo(ext)
+	}
+	repo, _, ok := splitRepoURI(uri, ext.SourceRepositoryURI, f.sep)
+	if !ok {
+		return sourceRepo(ext)
 	}
 	return repo
 }
 
+// buildConfigURL links to the exact version of the build config (e.g. the
+// GitHub Actions workflow file) that produced the signature. If a link can't
+// be constructed, the build config URI is returned as-is.
 func buildConfigURL(ext certificate.Extensions) string {
+	uri, _, _ := strings.Cut(ext.BuildConfigURI, "@")
+	f, ok := forgeOf(uri)
+	if !ok || ext.BuildConfigDigest == "" {
+		return ext.BuildConfigURI
+	}
+	repo, path, ok := splitRepoURI(uri, ext.SourceRepositoryURI, f.sep)
+	if !ok {
+		return ext.BuildConfigURI
+	}
+	return fmt.Sprintf(f.blob, repo, ext.BuildConfigDigest, path)
+}
+
+// splitRepoURI splits a build config URI (without its @ref) into the
+// repository URI and the path of the file within it. The source repository is
+// used if the build config lives in it; otherwise (e.g. reusable workflows
+// from another repo), the repository is taken from the URI itself, either
+// split at sep or assumed to be the first two path elements.
+func splitRepoURI(uri, sourceRepo, sep string) (repo, path string, ok bool) {
 	switch {
-	case strings.HasPrefix(ext.BuildConfigURI, "https://github.com"):
-		path := strings.TrimPrefix(ext.BuildConfigURI, ext.SourceRepositoryURI)
-		path, _, _ = strings.Cut(path, "@")
-		path = strings.Trim(path, "/")
-		return fmt.Sprintf("%s/blob/%s/%s", ext.SourceRepositoryURI, ext.BuildConfigDigest, path)
-	case strings.HasPrefix(ext.BuildConfigURI, "https://gitlab.com"):
-		path := strings.TrimPrefix(ext.BuildConfigURI, ext.SourceRepositoryURI)
-		path, _, _ = strings.Cut(path, "@")
-		path = strings.Trim(path, "/")
-		return fmt.Sprintf("%s/-/blob/%s/%s", ext.SourceRepositoryURI, ext.BuildConfigDigest, path)
-	}
-	return ext.BuildConfigURI
-}
-
-func getAttestations(ref name.Reference) (name.Digest, []*SignatureData, error) {
-	attRef, err := ociremote.AttestationTag(ref)
+	case sourceRepo != "" && strings.HasPrefix(uri, strings.TrimSuffix(sourceRepo, "/")+"/"):
+		repo = strings.TrimSuffix(sourceRepo, "/")
+		path = strings.TrimPrefix(uri, repo)
+	case sep != "" && strings.Contains(strings.TrimPrefix(uri, "https://"), sep):
+		repo, path, _ = strings.Cut(strings.TrimPrefix(uri, "https://"), sep)
+		repo = "https://" + repo
+	default:
+		parts := strings.SplitN(strings.TrimPrefix(uri, "https://"), "/", 4)
+		if len(parts) < 4 {
+			return "", "", false
+		}
+		repo = "https://" + strings.Join(parts[:3], "/")
+		path = parts[3]
+	}
+
+	// Make sure we're left with something that looks like a file path.
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return "", "", false
+	}
+	for _, p := range strings.Split(path, "/") {
+		if p == "" || p == "." || p == ".." {
+			return "", "", false
+		}
+	}
+	return repo, path, true
+}
+
+func getAttestations(ctx context.Context, ref name.Reference, ro []ociremote.Option, opts ...remote.Option) (*manifest, error) {
+	attRef, err := ociremote.AttestationTag(ref, append(ro, ociremote.WithRemoteOptions(opts...))...)
 	if err != nil {
-		return name.Digest{}, nil, fmt.Errorf("error getting signature tag: %v", err)
+		return &manifest{}, fmt.Errorf("error getting attestation tag: %v", err)
 	}
 
-	return getData(attRef)
+	m, err := getData(ctx, attRef, opts...)
+	if isNotFound(err) {
+		return &manifest{}, nil
+	}
+	return m, err
 }
 
-func issuerIcon(issuer string) string {
-	switch issuer {
-	case "https://token.actions.githubusercontent.com":
-		return "https://github.githubassets.com/images/modules/logos_page/GitHub-Mark.png"
-	case "https://gitlab.com":
-		return "https://about.gitlab.com/images/press/press-kit-icon.svg"
-	case "https://accounts.google.com":
-		return "https://lh3.googleusercontent.com/COxitqgJr1sJnIDe8-jiKhxDx1FrYbtRHKJ9z_hELisAlapwE9LUPh6fcXIfb5vwpbMl4xl9H9TRFPc5NOO8Sb3VSgIBrfRYvW6cUA"
+func toJSON(v any) (string, error) {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// sbomFormat returns the SBOM format of a layer media type, if it is one.
+func sbomFormat(mediaType string) string {
+	switch {
+	case strings.Contains(mediaType, "spdx"):
+		return "SPDX"
+	case strings.Contains(mediaType, "cyclonedx"):
+		return "CycloneDX"
+	case strings.Contains(mediaType, "syft"):
+		return "Syft"
 	}
 	return ""
 }
 
+// issuerInfo is how we display an OIDC issuer.
+type issuerInfo struct {
+	Name string
+	// Icon is the URL of an icon for the issuer, if we know of one.
+	Icon string
+}
+
+// knownIssuers are the issuers commonly seen in Fulcio certificates. Issuers
+// with per-tenant URLs are matched by prefix.
+var knownIssuers = []struct {
+	issuer string
+	prefix bool
+	info   issuerInfo
+}{
+	{"https://token.actions.githubusercontent.com", false, issuerInfo{"GitHub Actions", "https://github.githubassets.com/images/modules/logos_page/GitHub-Mark.png"}},
+	// GitHub Enterprise Cloud with a custom issuer.
+	{"https://token.actions.githubusercontent.com/", true, issuerInfo{"GitHub Enterprise", "https://github.githubassets.com/images/modules/logos_page/GitHub-Mark.png"}},
+	{"https://gitlab.com", false, issuerInfo{"GitLab", "https://about.gitlab.com/images/press/press-kit-icon.svg"}},
+	{"https://accounts.google.com", false, issuerInfo{"Google", "https://lh3.googleusercontent.com/COxitqgJr1sJnIDe8-jiKhxDx1FrYbtRHKJ9z_hELisAlapwE9LUPh6fcXIfb5vwpbMl4xl9H9TRFPc5NOO8Sb3VSgIBrfRYvW6cUA"}},
+	{"https://oauth2.sigstore.dev/auth", false, issuerInfo{"Sigstore", "https://www.sigstore.dev/favicon.ico"}},
+	{"https://login.microsoftonline.com", true, issuerInfo{"Microsoft", "https://www.microsoft.com/favicon.ico"}},
+	{"https://vstoken.dev.azure.com/", true, issuerInfo{"Azure DevOps", "https://cdn.vsassets.io/content/icons/favicon.ico"}},
+	{"https://agent.buildkite.com", false, issuerInfo{"Buildkite", "https://buildkite.com/favicon.ico"}},
+	{"https://oidc.circleci.com/org/", true, issuerInfo{"CircleCI", "https://circleci.com/favicon.ico"}},
+	{"https://oidc.codefresh.io", false, issuerInfo{"Codefresh", "https://codefresh.io/favicon.ico"}},
+}
+
+// issuer returns how to display the given OIDC issuer. Unknown issuers are
+// labelled with their host.
+func issuer(iss string) issuerInfo {
+	for _, k := range knownIssuers {
+		if iss == k.issuer || (k.prefix && strings.HasPrefix(iss, k.issuer)) {
+			return k.info
+		}
+	}
+	// Self-hosted GitHub Enterprise Server.
+	if strings.HasSuffix(iss, "/_services/token") {
+		return issuerInfo{Name: "GitHub Enterprise Server", Icon: "https://github.githubassets.com/images/modules/logos_page/GitHub-Mark.png"}
+	}
+	if u, err := url.Parse(iss); err == nil && u.Host != "" {
+		return issuerInfo{Name: u.Host}
+	}
+	return issuerInfo{Name: iss}
+}
+
 func subjectAltName(cert *x509.Certificate) string {
+	return strings.Join(sans(cert), " ")
+}
+
+// certKeyInfo describes the certificate's public key, e.g. "ECDSA P-256".
+func certKeyInfo(cert *x509.Certificate) string {
 	if cert == nil {
 		return ""
 	}
-	url := make([]string, 0, len(cert.URIs))
+	switch k := cert.PublicKey.(type) {
+	case *ecdsa.PublicKey:
+		return fmt.Sprintf("ECDSA %s", k.Curve.Params().Name)
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA %d", k.N.BitLen())
+	case ed25519.PublicKey:
+		return "Ed25519"
+	}
+	return cert.PublicKeyAlgorithm.String()
+}
+
+// certValidity formats the window in which cert is valid.
+func certValidity(cert *x509.Certificate) template.HTML {
+	if cert == nil {
+		return ""
+	}
+	return relTime(cert.NotBefore) + " – " + relTime(cert.NotAfter) + template.HTML(fmt.Sprintf(" (%s)", cert.NotAfter.Sub(cert.NotBefore)))
+}
+
+// certChain describes who issued cert and each certificate in chain after it,
+// e.g. "sigstore-intermediate → sigstore (root)". With no chain only the
+// leaf's issuer is known.
+func certChain(cert *x509.Certificate, chain []*x509.Certificate) string {
+	if cert == nil {
+		return ""
+	}
+	names := []string{certName(cert.Issuer)}
+	for _, c := range chain {
+		if bytes.Equal(c.RawSubject, c.RawIssuer) {
+			names[len(names)-1] += " (root)"
+			break
+		}
+		names = append(names, certName(c.Issuer))
+	}
+	return strings.Join(names, " → ")
+}
+
+// certName is the common name of n, falling back to the full DN.
+func certName(n pkix.Name) string {
+	if n.CommonName != "" {
+		return n.CommonName
+	}
+	return n.String()
+}
+
+// signedWhileValid reports whether the Rekor integrated time t falls within
+// cert's validity window. Bundles that don't record an integrated time (zero)
+// can't say either way, so the template doesn't ask.
+func signedWhileValid(cert *x509.Certificate, t int64) bool {
+	signed := time.Unix(t, 0)
+	return !signed.Before(cert.NotBefore) && !signed.After(cert.NotAfter)
+}
+
+// certPEM returns cert PEM encoded, or "" for key-based signatures.
+func certPEM(cert *x509.Certificate) string {
+	if cert == nil {
+		return ""
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+}
+
+// certDownloadURL returns a data URL for downloading cert as a PEM file.
+func certDownloadURL(cert *x509.Certificate) template.URL {
+	if cert == nil {
+		return ""
+	}
+	// html/template rejects data URLs by default, but we built this one.
+	return template.URL("data:application/x-pem-file;base64," + base64.StdEncoding.EncodeToString([]byte(certPEM(cert))))
+}
+
+func sans(cert *x509.Certificate) []string {
+	if cert == nil {
+		return nil
+	}
+	out := make([]string, 0, len(cert.EmailAddresses)+len(cert.URIs))
+	out = append(out, cert.EmailAddresses...)
 	for _, u := range cert.URIs {
-		url = append(url, u.String())
+		out = append(out, u.String())
 	}
-	return strings.Join(append(cert.EmailAddresses, url...), " ")
+	return out
 }
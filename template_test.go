@@ -0,0 +1,111 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/sigstore/fulcio/pkg/certificate"
+)
+
+func TestIssuer(t *testing.T) {
+	for _, tt := range []struct {
+		issuer string
+		want   string
+		icon   bool
+	}{
+		{"https://token.actions.githubusercontent.com", "GitHub Actions", true},
+		{"https://token.actions.githubusercontent.com/acme", "GitHub Enterprise", true},
+		{"https://github.acme.com/_services/token", "GitHub Enterprise Server", true},
+		{"https://gitlab.com", "GitLab", true},
+		{"https://accounts.google.com", "Google", true},
+		{"https://oauth2.sigstore.dev/auth", "Sigstore", true},
+		{"https://login.microsoftonline.com/tenant/v2.0", "Microsoft", true},
+		{"https://vstoken.dev.azure.com/org", "Azure DevOps", true},
+		{"https://agent.buildkite.com", "Buildkite", true},
+		{"https://oidc.circleci.com/org/1234", "CircleCI", true},
+		{"https://oidc.codefresh.io", "Codefresh", true},
+		// Unknown issuers fall back to their host.
+		{"https://oidc.example.com/realms/ci", "oidc.example.com", false},
+		{"not a url", "not a url", false},
+	} {
+		got := issuer(tt.issuer)
+		if got.Name != tt.want || (got.Icon != "") != tt.icon {
+			t.Errorf("issuer(%q): got %+v, want %q (icon: %t)", tt.issuer, got, tt.want, tt.icon)
+		}
+	}
+}
+
+func TestKnownIssuers(t *testing.T) {
+	// Every issuer in the table has to be shown as something friendlier than
+	// its host.
+	for _, k := range knownIssuers {
+		if k.info.Name == "" || k.info.Icon == "" {
+			t.Errorf("%s: missing name or icon: %+v", k.issuer, k.info)
+		}
+		if got := issuer(k.issuer); got != k.info {
+			t.Errorf("issuer(%q): got %+v, want %+v", k.issuer, got, k.info)
+		}
+	}
+}
+
+func TestShaURL(t *testing.T) {
+	const sha = "0123456789abcdef0123456789abcdef01234567"
+	for _, tt := range []struct {
+		repo, want string
+	}{
+		{"https://github.com/foo/bar", "https://github.com/foo/bar/commit/" + sha},
+		{"https://github.com/foo/bar/", "https://github.com/foo/bar/commit/" + sha},
+		{"https://gitlab.com/group/subgroup/project", "https://gitlab.com/group/subgroup/project/-/commit/" + sha},
+		{"https://gitlab.example.com/foo/bar", "https://gitlab.example.com/foo/bar/-/commit/" + sha},
+		{"https://bitbucket.org/foo/bar", "https://bitbucket.org/foo/bar/commits/" + sha},
+		{"https://codeberg.org/foo/bar", "https://codeberg.org/foo/bar/commit/" + sha},
+		{"https://gitea.com/foo/bar", "https://gitea.com/foo/bar/commit/" + sha},
+		{"https://forgejo.example.com/foo/bar", "https://forgejo.example.com/foo/bar/commit/" + sha},
+		// Unknown hosts just link to the repository.
+		{"https://git.example.com/foo/bar", "https://git.example.com/foo/bar"},
+	} {
+		if got := shaURL(tt.repo, sha); got != tt.want {
+			t.Errorf("shaURL(%q): got %q, want %q", tt.repo, got, tt.want)
+		}
+	}
+	if got := shaURL("https://github.com/foo/bar", ""); got != "https://github.com/foo/bar" {
+		t.Errorf("without a commit: got %q, want the repository", got)
+	}
+}
+
+func TestGitHubEnterpriseLinks(t *testing.T) {
+	ext := certificate.Extensions{
+		SourceRepositoryURI: "https://github.acme.com/foo/bar",
+		BuildConfigURI:      "https://github.acme.com/foo/bar/.github/workflows/release.yaml@refs/heads/main",
+		BuildConfigDigest:   "abc",
+	}
+	// GHES hosts aren't recognized until they're configured.
+	if got := shaURL(ext.SourceRepositoryURI, "abc"); got != ext.SourceRepositoryURI {
+		t.Errorf("unconfigured shaURL: got %q, want the repository", got)
+	}
+	if got := buildConfigURL(ext); got != ext.BuildConfigURI {
+		t.Errorf("unconfigured buildConfigURL: got %q, want the URI as is", got)
+	}
+
+	githubEnterpriseHosts["github.acme.com"] = true
+	t.Cleanup(func() { delete(githubEnterpriseHosts, "github.acme.com") })
+	if got, want := shaURL(ext.SourceRepositoryURI, "abc"), "https://github.acme.com/foo/bar/commit/abc"; got != want {
+		t.Errorf("shaURL: got %q, want %q", got, want)
+	}
+	if got, want := buildConfigURL(ext), "https://github.acme.com/foo/bar/blob/abc/.github/workflows/release.yaml"; got != want {
+		t.Errorf("buildConfigURL: got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,396 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gomarkdown/markdown"
+	"github.com/gomarkdown/markdown/ast"
+	"github.com/gomarkdown/markdown/parser"
+	"golang.org/x/text/width"
+)
+
+// ANSI SGR parameters for each part of the terminal output.
+const (
+	sgrTitle   = "1;35"
+	sgrHeading = "1;36"
+	sgrStrong  = "1"
+	sgrDim     = "2"
+	sgrEmph    = "3"
+	sgrLink    = "4"
+	sgrCode    = "33"
+	sgrQuote   = "36"
+)
+
+var (
+	// ansiEscape matches the SGR and OSC 8 (hyperlink) sequences the
+	// terminal renderer writes, neither of which take up any columns.
+	ansiEscape  = regexp.MustCompile("\x1b\\[[0-9;]*m|\x1b\\]8;;[^\x1b]*\x1b\\\\")
+	htmlTag     = regexp.MustCompile(`<[^>]*>`)
+	htmlTagName = regexp.MustCompile(`^<(/?)([a-zA-Z0-9]+)`)
+	blankLines  = regexp.MustCompile(`\n{3,}`)
+)
+
+// renderTerm renders the markdown md for a terminal: box-drawn headings and
+// tables, with ANSI colors unless color is false.
+//
+// The templates are written for the web page, so this only has to cope with
+// what they produce, including the few inline HTML tags they use.
+func renderTerm(md []byte, color bool) []byte {
+	doc := parser.NewWithExtensions(markdownExtensions).Parse(md)
+	out := markdown.Render(doc, &termRenderer{color: color})
+	out = blankLines.ReplaceAll(out, []byte("\n\n"))
+	return append(bytes.TrimSpace(out), '\n')
+}
+
+// termRenderer is a markdown.Renderer writing styled text for a terminal.
+type termRenderer struct {
+	color bool
+	// styles are the SGR parameters in effect, innermost last, so that
+	// closing a span can restore whatever encloses it.
+	styles []string
+}
+
+func (r *termRenderer) RenderHeader(io.Writer, ast.Node) {}
+func (r *termRenderer) RenderFooter(io.Writer, ast.Node) {}
+
+func (r *termRenderer) push(w io.Writer, sgr string) {
+	r.styles = append(r.styles, sgr)
+	if r.color {
+		fmt.Fprintf(w, "\x1b[%sm", sgr)
+	}
+}
+
+func (r *termRenderer) pop(w io.Writer) {
+	if len(r.styles) == 0 {
+		return
+	}
+	r.styles = r.styles[:len(r.styles)-1]
+	if r.color {
+		io.WriteString(w, "\x1b[0m")
+		for _, sgr := range r.styles {
+			fmt.Fprintf(w, "\x1b[%sm", sgr)
+		}
+	}
+}
+
+// styled returns s in the style sgr, on its own.
+func (r *termRenderer) styled(sgr, s string) string {
+	if !r.color || s == "" {
+		return s
+	}
+	return "\x1b[" + sgr + "m" + s + "\x1b[0m"
+}
+
+// children renders node's children on their own, e.g. to lay out a table
+// cell once its width is known.
+func (r *termRenderer) children(node ast.Node) string {
+	var b bytes.Buffer
+	for _, c := range node.GetChildren() {
+		ast.WalkFunc(c, func(n ast.Node, entering bool) ast.WalkStatus {
+			return r.RenderNode(&b, n, entering)
+		})
+	}
+	return b.String()
+}
+
+func (r *termRenderer) RenderNode(w io.Writer, node ast.Node, entering bool) ast.WalkStatus {
+	switch node := node.(type) {
+	case *ast.Text:
+		if entering {
+			io.WriteString(w, termText(node.Literal))
+		}
+	case *ast.Code:
+		if entering {
+			io.WriteString(w, r.styled(sgrCode, termText(node.Literal)))
+		}
+	case *ast.Strong:
+		r.span(w, sgrStrong, entering)
+	case *ast.Emph:
+		r.span(w, sgrEmph, entering)
+	case *ast.Link:
+		r.link(w, node, entering)
+	case *ast.Image:
+		return ast.SkipChildren
+	case *ast.HTMLSpan:
+		r.htmlSpan(w, string(node.Literal))
+	case *ast.HTMLBlock:
+		if text := strings.TrimSpace(termText(htmlTag.ReplaceAll(node.Literal, nil))); text != "" {
+			io.WriteString(w, text+"\n\n")
+		}
+	case *ast.Softbreak, *ast.Hardbreak:
+		io.WriteString(w, "\n")
+	case *ast.Heading:
+		if entering {
+			r.heading(w, node)
+		}
+		return ast.SkipChildren
+	case *ast.Paragraph:
+		if !entering {
+			if _, ok := node.Parent.(*ast.ListItem); ok {
+				io.WriteString(w, "\n")
+			} else {
+				io.WriteString(w, "\n\n")
+			}
+		}
+	case *ast.BlockQuote:
+		if entering {
+			r.blockQuote(w, node)
+		}
+		return ast.SkipChildren
+	case *ast.List:
+		if !entering {
+			io.WriteString(w, "\n")
+		}
+	case *ast.ListItem:
+		if entering {
+			r.listItem(w, node)
+		}
+	case *ast.CodeBlock:
+		for _, line := range strings.Split(strings.TrimRight(stripControls(string(node.Literal)), "\n"), "\n") {
+			io.WriteString(w, "    "+r.styled(sgrCode, line)+"\n")
+		}
+		io.WriteString(w, "\n")
+	case *ast.HorizontalRule:
+		io.WriteString(w, r.styled(sgrDim, strings.Repeat("─", 40))+"\n\n")
+	case *ast.Table:
+		if entering {
+			r.table(w, node)
+		}
+		return ast.SkipChildren
+	}
+	return ast.GoToNext
+}
+
+func (r *termRenderer) span(w io.Writer, sgr string, entering bool) {
+	if entering {
+		r.push(w, sgr)
+	} else {
+		r.pop(w)
+	}
+}
+
+// link shows absolute links as terminal hyperlinks, or spells out where they
+// go if there's no color. Links within oci.fyi mean nothing on the terminal,
+// so just their text is shown.
+func (r *termRenderer) link(w io.Writer, link *ast.Link, entering bool) {
+	dest := stripControls(string(link.Destination))
+	u, err := url.Parse(dest)
+	if err != nil || !u.IsAbs() {
+		return
+	}
+	if r.color {
+		if entering {
+			fmt.Fprintf(w, "\x1b]8;;%s\x1b\\", dest)
+			r.push(w, sgrLink)
+		} else {
+			r.pop(w)
+			io.WriteString(w, "\x1b]8;;\x1b\\")
+		}
+		return
+	}
+	if !entering && r.textOf(link) != dest {
+		fmt.Fprintf(w, " <%s>", dest)
+	}
+}
+
+// textOf is the plain text of node's children.
+func (r *termRenderer) textOf(node ast.Node) string {
+	return ansiEscape.ReplaceAllString(r.children(node), "")
+}
+
+// htmlSpan styles the inline tags the templates use, and drops the rest.
+func (r *termRenderer) htmlSpan(w io.Writer, tag string) {
+	m := htmlTagName.FindStringSubmatch(tag)
+	if m == nil {
+		return
+	}
+	closing := m[1] != ""
+	var sgr string
+	switch strings.ToLower(m[2]) {
+	case "code":
+		sgr = sgrCode
+	case "i", "em":
+		sgr = sgrEmph
+	case "b", "strong":
+		sgr = sgrStrong
+	case "br":
+		io.WriteString(w, "\n")
+		return
+	default:
+		return
+	}
+	r.span(w, sgr, !closing)
+}
+
+// blockQuote marks each line of the quote with a bar down the left.
+func (r *termRenderer) blockQuote(w io.Writer, bq *ast.BlockQuote) {
+	bar := r.styled(sgrQuote, "│") + " "
+	for _, line := range strings.Split(strings.TrimSpace(r.children(bq)), "\n") {
+		io.WriteString(w, strings.TrimRight(bar+line, " ")+"\n")
+	}
+	io.WriteString(w, "\n")
+}
+
+// heading underlines headings, more heavily for the page title.
+func (r *termRenderer) heading(w io.Writer, h *ast.Heading) {
+	sgr, rule := sgrHeading, "─"
+	if h.Level == 1 {
+		sgr, rule = sgrTitle, "━"
+	}
+	var b bytes.Buffer
+	r.push(&b, sgr)
+	b.WriteString(strings.TrimSpace(r.children(h)))
+	r.pop(&b)
+	fmt.Fprintf(w, "\n%s\n%s\n\n", b.String(), r.styled(sgrDim, strings.Repeat(rule, visibleWidth(b.String()))))
+}
+
+func (r *termRenderer) listItem(w io.Writer, item *ast.ListItem) {
+	depth := -1
+	for p := item.Parent; p != nil; p = p.GetParent() {
+		if _, ok := p.(*ast.List); ok {
+			depth++
+		}
+	}
+	marker := "•"
+	if item.ListFlags&ast.ListTypeOrdered != 0 {
+		for i, c := range item.Parent.GetChildren() {
+			if c == item {
+				marker = strconv.Itoa(i+1) + "."
+			}
+		}
+	}
+	io.WriteString(w, strings.Repeat("  ", depth)+marker+" ")
+}
+
+// table draws a box around the table's cells, leaving out header rows with
+// nothing in them (the templates' two column tables have no header).
+func (r *termRenderer) table(w io.Writer, table *ast.Table) {
+	var rows [][]string
+	header := 0
+	for _, part := range table.GetChildren() {
+		for _, row := range part.GetChildren() {
+			var cells []string
+			empty := true
+			for _, cell := range row.GetChildren() {
+				c := strings.TrimSpace(strings.ReplaceAll(r.children(cell), "\n", " "))
+				if _, ok := part.(*ast.TableHeader); ok {
+					c = r.styled(sgrStrong, c)
+				}
+				empty = empty && c == ""
+				cells = append(cells, c)
+			}
+			if _, ok := part.(*ast.TableHeader); ok {
+				if empty {
+					continue
+				}
+				header++
+			}
+			rows = append(rows, cells)
+		}
+	}
+	if len(rows) == 0 {
+		return
+	}
+
+	var widths []int
+	for _, row := range rows {
+		for i, c := range row {
+			if i == len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[i] = max(widths[i], visibleWidth(c))
+		}
+	}
+	border := func(left, mid, right string) {
+		parts := make([]string, len(widths))
+		for i, n := range widths {
+			parts[i] = strings.Repeat("─", n+2)
+		}
+		io.WriteString(w, r.styled(sgrDim, left+strings.Join(parts, mid)+right)+"\n")
+	}
+	bar := r.styled(sgrDim, "│")
+
+	border("┌", "┬", "┐")
+	for i, row := range rows {
+		if i > 0 && i == header {
+			border("├", "┼", "┤")
+		}
+		io.WriteString(w, bar)
+		for j, n := range widths {
+			var c string
+			if j < len(row) {
+				c = row[j]
+			}
+			io.WriteString(w, " "+c+strings.Repeat(" ", n-visibleWidth(c))+" "+bar)
+		}
+		io.WriteString(w, "\n")
+	}
+	border("└", "┴", "┘")
+	io.WriteString(w, "\n")
+}
+
+// termText is the text of a markdown node, unescaped and safe to write to a
+// terminal.
+func termText(literal []byte) string {
+	return stripControls(html.UnescapeString(string(literal)))
+}
+
+// stripControls removes control characters other than newlines and tabs from
+// s. Much of what's shown comes from the registry (annotations, SANs, SBOM
+// package names...), and escape sequences in it could restyle the output or
+// worse, e.g. set the clipboard with OSC 52.
+func stripControls(s string) string {
+	return strings.Map(func(c rune) rune {
+		if unicode.IsControl(c) && c != '\n' && c != '\t' {
+			return -1
+		}
+		return c
+	}, s)
+}
+
+// visibleWidth is how many terminal columns s takes up, allowing for escape
+// sequences, wide characters (e.g. most emoji) and combining marks.
+func visibleWidth(s string) int {
+	n, last := 0, 0
+	for _, c := range ansiEscape.ReplaceAllString(s, "") {
+		switch {
+		case c == '\ufe0f':
+			// An emoji presentation selector widens whatever it follows.
+			if last == 1 {
+				n++
+				last = 2
+			}
+			continue
+		case c == '\u200d', c == '\ufe0e', unicode.Is(unicode.Mn, c), unicode.IsControl(c):
+			continue
+		}
+		last = 1
+		if k := width.LookupRune(c).Kind(); k == width.EastAsianWide || k == width.EastAsianFullwidth {
+			last = 2
+		}
+		n += last
+	}
+	return n
+}
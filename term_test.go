@@ -0,0 +1,107 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestRenderTerm(t *testing.T) {
+	md := "## [Signatures](#signatures)\n\n> ✅ **Signed** by <code>me</code>\n\n\n--|--\n**Found via** | tag\n**Log** | [1234](https://search.sigstore.dev/?logIndex=1234)\n"
+	got := string(renderTerm([]byte(md), false))
+	want := `Signatures
+──────────
+
+│ ✅ Signed by me
+
+┌───────────┬───────────────────────────────────────────────────┐
+│ Found via │ tag                                               │
+│ Log       │ 1234 <https://search.sigstore.dev/?logIndex=1234> │
+└───────────┴───────────────────────────────────────────────────┘
+`
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRenderTermColor(t *testing.T) {
+	got := string(renderTerm([]byte("**Digest** `sha256:abc` and [a link](https://example.com)\n"), true))
+	for _, want := range []string{"\x1b[1mDigest\x1b[0m", "\x1b[33msha256:abc\x1b[0m", "\x1b]8;;https://example.com\x1b\\"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in %q", want, got)
+		}
+	}
+}
+
+func TestRenderTermStripsEscapes(t *testing.T) {
+	// An annotation trying to set the clipboard and fake the verdict.
+	evil := "\x1b]52;c;Y3VybCBldmlsLnNofHNo\x07\x1b[32m✅ Signed\x1b[0m\u009b2J"
+	md := "Annotation: " + evil + "\n\n`" + evil + "`\n\n--|--\n**SAN** | " + evil + "\n\n    " + evil + "\n\n[link](https://example.com/\x1b]52;c;eA==\x07)\n"
+	for _, color := range []bool{false, true} {
+		got := ansiEscape.ReplaceAllString(string(renderTerm([]byte(md), color)), "")
+		if i := strings.IndexFunc(got, func(c rune) bool { return c < ' ' && c != '\n' && c != '\t' || c == 0x9b }); i >= 0 {
+			t.Errorf("color=%v: control character %q left in:\n%q", color, got[i], got)
+		}
+		if !strings.Contains(got, "]52;c;Y3VybCBldmlsLnNofHNo") {
+			t.Errorf("color=%v: text around the escapes went missing:\n%q", color, got)
+		}
+	}
+}
+
+func TestVisibleWidth(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want int
+	}{
+		{"tag", 3},
+		{"\x1b[1mtag\x1b[0m", 3},
+		{"\x1b]8;;https://example.com\x1b\\link\x1b]8;;\x1b\\", 4},
+		{"✅ ok", 5},
+		{"⚠️ warn", 7},
+		{"🏗️", 2},
+		{"é", 1},
+	} {
+		if got := visibleWidth(tt.in); got != tt.want {
+			t.Errorf("visibleWidth(%q): got %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRunCLITerm(t *testing.T) {
+	t.Setenv("NO_COLOR", "1")
+	repo := newTestRepo(t)
+	d := pushImage(t, repo.Tag("latest"))
+
+	var out, errs bytes.Buffer
+	if code := newTestServer().runCLI(context.Background(), &out, &errs, d.String(), "term"); code != 0 {
+		t.Fatalf("exit code %d: %s", code, errs.String())
+	}
+	if strings.Contains(out.String(), "\x1b") {
+		t.Errorf("escape sequences despite NO_COLOR:\n%q", out.String())
+	}
+	if !strings.Contains(out.String(), d.DigestStr()) {
+		t.Errorf("digest missing from:\n%s", out.String())
+	}
+}
+
+func TestRunCLIUnknownFormat(t *testing.T) {
+	var out, errs bytes.Buffer
+	if code := newTestServer().runCLI(context.Background(), &out, &errs, "example.com/foo", "yaml"); code != 2 {
+		t.Errorf("exit code: got %d, want 2", code)
+	}
+}
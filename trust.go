@@ -0,0 +1,196 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	ctypes "github.com/sigstore/cosign/v2/pkg/types"
+)
+
+// trustFactor is one of the signals that make up a trustSummary.
+type trustFactor struct {
+	Name string
+	Met  bool
+	// Unverified is set if a signature claims the factor, but nothing
+	// backing the claim was verified. It doesn't count towards the score.
+	Unverified bool
+	// Detail explains why the factor was (or wasn't) met.
+	Detail string
+}
+
+// trustSummary is an at-a-glance overview of how much we know about where an
+// image came from.
+//
+// The scoring is deliberately simple so that it can be explained in one
+// line: every factor is worth one point, and a factor is met if any
+// signature or attestation on the image (or any platform of an index)
+// satisfies it. This is a summary of signals, not a policy decision - a
+// high score from an identity you don't trust is worth nothing.
+type trustSummary struct {
+	Factors []trustFactor
+}
+
+// Score is the number of factors met.
+func (t *trustSummary) Score() int {
+	n := 0
+	for _, f := range t.Factors {
+		if f.Met {
+			n++
+		}
+	}
+	return n
+}
+
+// hostedRunners are the RunnerEnvironment values for CI runners managed by
+// the forge, rather than by whoever owns the repository.
+var hostedRunners = []string{"github-hosted", "gitlab-hosted"}
+
+// trustClaim is the first value seen for a factor backed by verification,
+// and the first one only claimed by an unverified signature.
+type trustClaim struct {
+	verified, claimed string
+}
+
+func (c *trustClaim) see(v string, verified bool) {
+	switch {
+	case v == "":
+	case verified && c.verified == "":
+		c.verified = v
+	case !verified && c.claimed == "":
+		c.claimed = v
+	}
+}
+
+// passed reports whether v is a successful verification.
+func passed(v *verification) bool {
+	return v != nil && v.OK
+}
+
+// trustSummaryOf computes the trust summary for out.
+//
+// Certificates, their Fulcio extensions and Rekor bundles are all just data
+// in the registry until they're checked, so the factors built on them are
+// only met once verify=true has checked the certificate chain (through the
+// signature or its SCT) or the Rekor entry.
+func trustSummaryOf(out *output) *trustSummary {
+	var (
+		signed, verified, verifyChecked, attested bool
+		fulcio, tlog, hosted, repoMatch           trustClaim
+	)
+	for _, g := range out.Groups {
+		for _, m := range g.Data {
+			for _, d := range m.Data {
+				// A signature over some other digest says nothing about
+				// this image.
+				if d.DigestMismatch {
+					continue
+				}
+				if d.LayerType == ctypes.SimpleSigningMediaType || d.MessageSignature != nil {
+					signed = true
+				}
+				if d.PredicateType != "" {
+					attested = true
+				}
+				if d.Verification != nil {
+					verifyChecked = true
+					verified = verified || d.Verification.OK
+				}
+				if d.Bundle != nil {
+					tlog.see(strconv.FormatInt(d.Bundle.Payload.LogIndex, 10), passed(d.Tlog))
+				}
+				if d.Cert == nil {
+					continue
+				}
+				// Verifying the signature or the SCT chains the certificate
+				// to the Fulcio root; anyone can put sigstore.dev in a
+				// self-signed one.
+				certOK := passed(d.Verification) || passed(d.SCT)
+				if certOK || slices.Contains(d.Cert.Issuer.Organization, "sigstore.dev") {
+					fulcio.see(certName(d.Cert.Issuer), certOK)
+				}
+				if env := d.Extensions.RunnerEnvironment; slices.Contains(hostedRunners, env) {
+					hosted.see(env, certOK)
+				}
+				if src := d.Extensions.SourceRepositoryURI; sourceMatchesImage(src, out.ResolvedRef.Context().RepositoryStr()) {
+					repoMatch.see(src, certOK)
+				}
+			}
+		}
+	}
+
+	t := &trustSummary{}
+	add := func(name string, met bool, yes, no string) {
+		f := trustFactor{Name: name, Met: met, Detail: no}
+		if met {
+			f.Detail = yes
+		}
+		t.Factors = append(t.Factors, f)
+	}
+	check := "not checked, add verify=true to check"
+	if verifyChecked {
+		check = "it didn't verify"
+	}
+	addClaim := func(name string, c trustClaim, yes, unverified func(string) string, no string) {
+		if c.verified == "" && c.claimed != "" {
+			t.Factors = append(t.Factors, trustFactor{Name: name, Unverified: true, Detail: unverified(c.claimed) + " (" + check + ")"})
+			return
+		}
+		add(name, c.verified != "", yes(c.verified), no)
+	}
+
+	add("Signed", signed, "a cosign signature is attached", "no cosign signature found")
+	verifyDetail := check
+	if verifyChecked {
+		verifyDetail = "no signature verified against the sigstore trust root"
+	}
+	add("Verified", verified, "a signature verified against the sigstore trust root", verifyDetail)
+	addClaim("Fulcio certificate", fulcio,
+		func(v string) string { return "issued by " + v },
+		func(v string) string {
+			return "claims to be issued by " + v + ", but the certificate chain is unverified"
+		},
+		"no certificate issued by Fulcio")
+	addClaim("Transparency log", tlog,
+		func(v string) string { return "recorded in Rekor at index " + v },
+		func(v string) string { return "bundles Rekor entry " + v + ", but it's unverified" },
+		"no Rekor entry bundled")
+	addClaim("Hosted runner", hosted,
+		func(v string) string { return "built on a " + v + " runner" },
+		func(v string) string { return "claims a " + v + " runner, but the certificate is unverified" },
+		"not built on a forge-hosted runner")
+	addClaim("Source repository", repoMatch,
+		func(v string) string { return "built from " + v + ", matching the image name" },
+		func(v string) string { return "claims to be built from " + v + ", but the certificate is unverified" },
+		"no build from a repository matching the image name")
+	add("Attestations", attested, "attestations are attached", "no attestations found")
+	return t
+}
+
+// sourceMatchesImage reports whether the source repository URI src (e.g.
+// https://github.com/foo/bar) looks like the repository the image repo
+// (e.g. foo/bar or foo/bar/baz) was named after.
+func sourceMatchesImage(src, repo string) bool {
+	u, err := url.Parse(src)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	path := strings.ToLower(strings.Trim(u.Path, "/"))
+	repo = strings.ToLower(repo)
+	return path != "" && (repo == path || strings.HasPrefix(repo, path+"/"))
+}
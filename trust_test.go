@@ -0,0 +1,113 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/sigstore/cosign/v2/pkg/cosign/bundle"
+	ctypes "github.com/sigstore/cosign/v2/pkg/types"
+	"github.com/sigstore/fulcio/pkg/certificate"
+)
+
+// trustOf is the trust summary of an image on ghcr.io/foo/bar with the
+// signature s, by factor name.
+func trustOf(t *testing.T, s *SignatureData) map[string]trustFactor {
+	t.Helper()
+	d, err := name.NewDigest("ghcr.io/foo/bar@sha256:" + strings.Repeat("ab", 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := &output{
+		ResolvedRef: d,
+		Groups:      []*group{{Ref: d, Data: []*manifest{{Name: "Signatures", Data: []*SignatureData{s}}}}},
+	}
+	factors := map[string]trustFactor{}
+	for _, f := range trustSummaryOf(out).Factors {
+		factors[f.Name] = f
+	}
+	return factors
+}
+
+// forgedSignature is a keyless looking signature anyone could make: a
+// self-signed certificate claiming to be from Fulcio, with a Rekor bundle
+// that's never been checked.
+func forgedSignature(t *testing.T) *SignatureData {
+	cert, _ := newTestCert(t, &x509.Certificate{
+		Subject: pkix.Name{CommonName: "sigstore-intermediate", Organization: []string{"sigstore.dev"}},
+	})
+	return &SignatureData{
+		LayerType: ctypes.SimpleSigningMediaType,
+		Cert:      cert,
+		Bundle:    &bundle.RekorBundle{Payload: bundle.RekorPayload{LogIndex: 1234}},
+		Extensions: certificate.Extensions{
+			RunnerEnvironment:   "github-hosted",
+			SourceRepositoryURI: "https://github.com/foo/bar",
+		},
+	}
+}
+
+var claimFactors = []string{"Fulcio certificate", "Transparency log", "Hosted runner", "Source repository"}
+
+func TestTrustSummaryUnverified(t *testing.T) {
+	factors := trustOf(t, forgedSignature(t))
+	for _, n := range claimFactors {
+		if f := factors[n]; f.Met || !f.Unverified || !strings.Contains(f.Detail, "verify=true") {
+			t.Errorf("%s: got %+v, want an unverified claim", n, f)
+		}
+	}
+	if !factors["Signed"].Met {
+		t.Error("Signed: not met")
+	}
+}
+
+func TestTrustSummaryVerified(t *testing.T) {
+	s := forgedSignature(t)
+	s.Verification = &verification{OK: true}
+	s.Tlog = &verification{OK: true}
+	factors := trustOf(t, s)
+	for _, n := range claimFactors {
+		if f := factors[n]; !f.Met || f.Unverified {
+			t.Errorf("%s: got %+v, want met", n, f)
+		}
+	}
+}
+
+func TestTrustSummaryFailedVerification(t *testing.T) {
+	s := forgedSignature(t)
+	s.Verification = &verification{Error: "certificate signed by unknown authority"}
+	s.SCT = &verification{Error: "no SCT"}
+	s.Tlog = &verification{Error: "entry is from unknown log"}
+	for _, n := range claimFactors {
+		if f := trustOf(t, s)[n]; f.Met || !f.Unverified || !strings.Contains(f.Detail, "didn't verify") {
+			t.Errorf("%s: got %+v, want an unverified claim", n, f)
+		}
+	}
+}
+
+func TestTrustSummaryDigestMismatch(t *testing.T) {
+	s := forgedSignature(t)
+	s.Verification = &verification{OK: true}
+	s.DigestMismatch = true
+	for n, f := range trustOf(t, s) {
+		if f.Met || f.Unverified {
+			t.Errorf("%s: got %+v from a signature over another image", n, f)
+		}
+	}
+}
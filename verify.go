@@ -0,0 +1,308 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/sigstore/cosign/v2/pkg/cosign"
+	"github.com/sigstore/cosign/v2/pkg/oci"
+	ociremote "github.com/sigstore/cosign/v2/pkg/oci/remote"
+	"github.com/sigstore/rekor/pkg/generated/models"
+	rekorverify "github.com/sigstore/rekor/pkg/verify"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	"github.com/sigstore/sigstore/pkg/fulcioroots"
+	"github.com/sigstore/sigstore/pkg/signature"
+)
+
+// verification is the result of cryptographically verifying a signature.
+type verification struct {
+	OK bool
+	// Error explains why verification failed, if known.
+	Error string
+}
+
+// trustRoot is the sigstore public-good trust root. Fetching it goes through
+// TUF, so only do so once (and only if someone actually asks to verify).
+var trustRoot = sync.OnceValues(func() (*cosign.CheckOpts, error) {
+	ctx := context.Background()
+	roots, err := fulcioroots.Get()
+	if err != nil {
+		return nil, fmt.Errorf("error getting fulcio roots: %w", err)
+	}
+	intermediates, err := fulcioroots.GetIntermediates()
+	if err != nil {
+		return nil, fmt.Errorf("error getting fulcio intermediates: %w", err)
+	}
+	rekorPubs, err := cosign.GetRekorPubs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting rekor public keys: %w", err)
+	}
+	ctPubs, err := cosign.GetCTLogPubs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting ctlog public keys: %w", err)
+	}
+	return &cosign.CheckOpts{
+		RootCerts:         roots,
+		IntermediateCerts: intermediates,
+		RekorPubKeys:      rekorPubs,
+		CTLogPubKeys:      ctPubs,
+	}, nil
+})
+
+// claimVerifier checks the payload of a signature refers to the image.
+type claimVerifier func(sig oci.Signature, imageDigest v1.Hash, annotations map[string]interface{}) error
+
+// checkOpts returns the options for verifying signatures attached to an image.
+func checkOpts(claims claimVerifier, ro []ociremote.Option, opts ...remote.Option) (*cosign.CheckOpts, error) {
+	root, err := trustRoot()
+	if err != nil {
+		return nil, err
+	}
+	co := *root
+	co.RegistryClientOpts = append(ro, ociremote.WithRemoteOptions(opts...))
+	co.ClaimVerifier = claims
+	// We're here to show who signed the image, not enforce a policy on it.
+	co.Identities = []cosign.Identity{{IssuerRegExp: ".*", SubjectRegExp: ".*"}}
+	// Rely on the bundled Rekor entry rather than querying Rekor on every
+	// lookup.
+	co.Offline = true
+	return &co, nil
+}
+
+// verifySignatures verifies the signatures attached to digest, recording the
+// verdict on each entry of m.
+func verifySignatures(ctx context.Context, digest name.Digest, m *manifest, ro []ociremote.Option, opts ...remote.Option) {
+	co, err := checkOpts(cosign.SimpleClaimVerifier, ro, opts...)
+	if err != nil {
+		markVerified(m, nil, err)
+		return
+	}
+	sigs, _, err := cosign.VerifyImageSignatures(ctx, digest, co)
+	markVerified(m, sigs, err)
+
+	// cosign can't see detached signatures, so check those ourselves.
+	for _, s := range m.Data {
+		if s.DetachedSignature != nil {
+			s.Verification = verifyDetached(digest, s, co, opts...)
+		}
+	}
+}
+
+// verifyDetached verifies a signature stored in a separate blob against the
+// certificate and payload of s. Only keyless signatures can be verified this
+// way, as there's no key to check the others against. The bundled Rekor entry
+// isn't checked, since cosign's bundle verification only works on signatures
+// it loaded itself.
+func verifyDetached(digest name.Digest, s *SignatureData, co *cosign.CheckOpts, opts ...remote.Option) *verification {
+	if s.Cert == nil {
+		return &verification{Error: "detached signature has no certificate to verify it with"}
+	}
+	sig, err := readLayer(*s.DetachedSignature, opts...)
+	if err != nil {
+		return &verification{Error: fmt.Sprintf("error reading detached signature: %v", err)}
+	}
+	// The blob may hold the signature as-is or base64 encoded, like the
+	// inline annotation.
+	if b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig))); err == nil {
+		sig = b
+	}
+	layer, ok := s.Layer.(name.Digest)
+	if !ok {
+		return &verification{Error: "signature payload isn't addressed by digest"}
+	}
+	payload, err := readLayer(layer, opts...)
+	if err != nil {
+		return &verification{Error: fmt.Sprintf("error reading signature payload: %v", err)}
+	}
+
+	// The chain annotation can supply intermediates missing from the trust
+	// root, but the root itself still has to be one we trust.
+	if len(s.Chain) > 0 {
+		cco := *co
+		if co.IntermediateCerts != nil {
+			cco.IntermediateCerts = co.IntermediateCerts.Clone()
+		} else {
+			cco.IntermediateCerts = x509.NewCertPool()
+		}
+		for _, c := range s.Chain {
+			cco.IntermediateCerts.AddCert(c)
+		}
+		co = &cco
+	}
+	// ValidateAndUnpackCert strips extensions it can't handle from the
+	// certificate, so give it a copy.
+	cert := *s.Cert
+	verifier, err := cosign.ValidateAndUnpackCert(&cert, co)
+	if err != nil {
+		return &verification{Error: err.Error()}
+	}
+	if err := verifier.VerifySignature(bytes.NewReader(sig), bytes.NewReader(payload)); err != nil {
+		return &verification{Error: fmt.Sprintf("invalid detached signature: %v", err)}
+	}
+	if s.SignedDigest != digest.DigestStr() {
+		return &verification{Error: fmt.Sprintf("signature covers %s, not this image", s.SignedDigest)}
+	}
+	return &verification{OK: true}
+}
+
+// verifyAttestations verifies the attestations attached to digest, recording
+// the verdict on each entry of m.
+func verifyAttestations(ctx context.Context, digest name.Digest, m *manifest, ro []ociremote.Option, opts ...remote.Option) {
+	co, err := checkOpts(cosign.IntotoSubjectClaimVerifier, ro, opts...)
+	if err != nil {
+		markVerified(m, nil, err)
+		return
+	}
+	atts, _, err := cosign.VerifyImageAttestations(ctx, digest, co)
+	markVerified(m, atts, err)
+}
+
+// markVerified records which layers of m are in the verified set. cosign only
+// tells us which signatures passed, so failures all share the overall error.
+func markVerified(m *manifest, verified []oci.Signature, err error) {
+	ok := make(map[string]bool, len(verified))
+	for _, s := range verified {
+		if d, err := s.Digest(); err == nil {
+			ok[d.String()] = true
+		}
+	}
+	for _, s := range m.Data {
+		v := &verification{OK: ok[digestOf(s.Layer.String())]}
+		if !v.OK {
+			v.Error = "signature did not verify"
+			if err != nil {
+				v.Error = err.Error()
+			}
+		}
+		s.Verification = v
+	}
+}
+
+// verifySCT checks the signed certificate timestamp embedded in the Fulcio
+// certificate of s against the CT log keys of the trust root, recording the
+// verdict on s. Signatures without a certificate are left alone.
+func verifySCT(ctx context.Context, s *SignatureData) {
+	if s.Cert == nil {
+		return
+	}
+	root, err := trustRoot()
+	if err != nil {
+		s.SCT = &verification{Error: err.Error()}
+		return
+	}
+	// The SCT is over the certificate's issuer too, so we need the chain. If
+	// the signature didn't carry it, build it from the Fulcio roots.
+	chain := s.Chain
+	if len(chain) == 0 {
+		// Like cosign, ignore the critical SAN extension Go can't parse when
+		// Fulcio issues OtherName SANs.
+		cert := *s.Cert
+		cert.UnhandledCriticalExtensions = slices.DeleteFunc(slices.Clone(cert.UnhandledCriticalExtensions), func(oid asn1.ObjectIdentifier) bool {
+			return oid.Equal(cryptoutils.SANOID)
+		})
+		chains, err := cosign.TrustedCert(&cert, root.RootCerts, root.IntermediateCerts)
+		if err != nil {
+			s.SCT = &verification{Error: fmt.Sprintf("certificate doesn't chain to the Fulcio root: %v", err)}
+			return
+		}
+		chain = chains[0][1:]
+	}
+	if err := cosign.VerifyEmbeddedSCT(ctx, append([]*x509.Certificate{s.Cert}, chain...), root.CTLogPubKeys); err != nil {
+		s.SCT = &verification{Error: err.Error()}
+		return
+	}
+	s.SCT = &verification{OK: true}
+}
+
+// verifyTlog checks the Rekor entry bundled with s without contacting Rekor:
+// that Rekor signed its entry timestamp and, if the bundle carries an
+// inclusion proof, that the proof holds against a tree head Rekor signed. The
+// verdict is recorded on s. Signatures without a Rekor entry are left alone.
+func verifyTlog(ctx context.Context, s *SignatureData) {
+	if s.Bundle == nil {
+		return
+	}
+	root, err := trustRoot()
+	if err != nil {
+		s.Tlog = &verification{Error: err.Error()}
+		return
+	}
+	logID := s.Bundle.Payload.LogID
+	if root.RekorPubKeys == nil {
+		s.Tlog = &verification{Error: "no Rekor keys in the trust root"}
+		return
+	}
+	key, ok := root.RekorPubKeys.Keys[logID]
+	if !ok {
+		s.Tlog = &verification{Error: fmt.Sprintf("entry is from unknown log %s", logID)}
+		return
+	}
+	pub, ok := key.PubKey.(*ecdsa.PublicKey)
+	if !ok {
+		s.Tlog = &verification{Error: fmt.Sprintf("unsupported Rekor key type %T", key.PubKey)}
+		return
+	}
+	if len(s.Bundle.SignedEntryTimestamp) == 0 && s.InclusionProof == nil {
+		s.Tlog = &verification{Error: "entry has neither a signed entry timestamp nor an inclusion proof"}
+		return
+	}
+
+	if len(s.Bundle.SignedEntryTimestamp) > 0 {
+		if err := cosign.VerifySET(s.Bundle.Payload, s.Bundle.SignedEntryTimestamp, pub); err != nil {
+			s.Tlog = &verification{Error: fmt.Sprintf("invalid signed entry timestamp: %v", err)}
+			return
+		}
+	}
+	if s.InclusionProof != nil {
+		// cosign's bundle annotation has the body base64 encoded already,
+		// but sigstore bundles have it raw.
+		body := s.Bundle.Payload.Body
+		if b, ok := body.([]byte); ok {
+			body = base64.StdEncoding.EncodeToString(b)
+		}
+		e := &models.LogEntryAnon{
+			Body:         body,
+			Verification: &models.LogEntryAnonVerification{InclusionProof: s.InclusionProof},
+		}
+		if err := rekorverify.VerifyInclusion(ctx, e); err != nil {
+			s.Tlog = &verification{Error: fmt.Sprintf("invalid inclusion proof: %v", err)}
+			return
+		}
+		verifier, err := signature.LoadECDSAVerifier(pub, crypto.SHA256)
+		if err != nil {
+			s.Tlog = &verification{Error: err.Error()}
+			return
+		}
+		if err := rekorverify.VerifyCheckpointSignature(e, verifier); err != nil {
+			s.Tlog = &verification{Error: fmt.Sprintf("invalid checkpoint: %v", err)}
+			return
+		}
+	}
+	s.Tlog = &verification{OK: true}
+}
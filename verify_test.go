@@ -0,0 +1,173 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"io"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/sigstore/cosign/v2/pkg/cosign"
+)
+
+// pushDetached signs signed with key, storing the signature in its own blob
+// as the detached layout does, and returns the parsed signature.
+func pushDetached(t *testing.T, signed name.Digest, key *ecdsa.PrivateKey, annotations map[string]string) *SignatureData {
+	t.Helper()
+	layer := signatureLayer(signed, annotations)
+	delete(layer.Annotations, signatureAnnotation)
+	payload, err := layer.Layer.Uncompressed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := sha256.Sum256(b)
+	sig, err := ecdsa.SignASN1(rand.Reader, key, h[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blob := static.NewLayer([]byte(base64.StdEncoding.EncodeToString(sig)), types.OCILayer)
+	if err := remote.WriteLayer(signed.Context(), blob); err != nil {
+		t.Fatal(err)
+	}
+	d, err := blob.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	layer.Annotations[detachedSignatureAnnotation] = d.String()
+
+	tag := cosignTag(signed, "sig")
+	pushManifest(t, tag, artifact(t, layer))
+	m, err := getData(context.Background(), tag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m.Data[0]
+}
+
+// testCheckOpts trusts roots, and nothing else.
+func testCheckOpts(roots ...*x509.Certificate) *cosign.CheckOpts {
+	pool := x509.NewCertPool()
+	for _, c := range roots {
+		pool.AddCert(c)
+	}
+	return &cosign.CheckOpts{
+		RootCerts:  pool,
+		Identities: []cosign.Identity{{IssuerRegExp: ".*", SubjectRegExp: ".*"}},
+		// The test CA doesn't log to CT.
+		IgnoreSCT: true,
+	}
+}
+
+func TestVerifyDetached(t *testing.T) {
+	repo := newTestRepo(t)
+	d := pushImage(t, repo.Tag("latest"))
+	ca := newTestCA(t, nil)
+	uri, err := url.Parse("https://github.com/foo/bar/.github/workflows/release.yaml@refs/heads/main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, key := ca.issue(t, &x509.Certificate{URIs: []*url.URL{uri}})
+
+	s := pushDetached(t, d, key, map[string]string{"dev.sigstore.cosign/certificate": certPEM(leaf)})
+	if s.DetachedSignature == nil {
+		t.Fatal("signature isn't detached")
+	}
+	if v := verifyDetached(d, s, testCheckOpts(ca.cert)); !v.OK {
+		t.Errorf("didn't verify: %s", v.Error)
+	}
+	// Someone else's CA isn't trusted.
+	if v := verifyDetached(d, s, testCheckOpts(newTestCA(t, nil).cert)); v.OK {
+		t.Error("verified against the wrong root")
+	}
+}
+
+func TestVerifyDetachedWrongKey(t *testing.T) {
+	repo := newTestRepo(t)
+	d := pushImage(t, repo.Tag("latest"))
+	ca := newTestCA(t, nil)
+	leaf, _ := ca.issue(t, &x509.Certificate{EmailAddresses: []string{"me@example.com"}})
+	_, other := ca.issue(t, &x509.Certificate{EmailAddresses: []string{"me@example.com"}})
+
+	s := pushDetached(t, d, other, map[string]string{"dev.sigstore.cosign/certificate": certPEM(leaf)})
+	if v := verifyDetached(d, s, testCheckOpts(ca.cert)); v.OK || !strings.Contains(v.Error, "invalid detached signature") {
+		t.Errorf("want a signature made by another key rejected, got %+v", v)
+	}
+}
+
+func TestVerifyDetachedOtherImage(t *testing.T) {
+	repo := newTestRepo(t)
+	d := pushImage(t, repo.Tag("latest"))
+	other := pushImage(t, repo.Tag("other"))
+	ca := newTestCA(t, nil)
+	leaf, key := ca.issue(t, &x509.Certificate{EmailAddresses: []string{"me@example.com"}})
+
+	// A valid signature, but of another image.
+	s := pushDetached(t, other, key, map[string]string{"dev.sigstore.cosign/certificate": certPEM(leaf)})
+	if v := verifyDetached(d, s, testCheckOpts(ca.cert)); v.OK || !strings.Contains(v.Error, "not this image") {
+		t.Errorf("want a signature of another image rejected, got %+v", v)
+	}
+}
+
+func TestVerifyDetachedKeyed(t *testing.T) {
+	repo := newTestRepo(t)
+	d := pushImage(t, repo.Tag("latest"))
+	_, key := newTestCA(t, nil).issue(t, &x509.Certificate{})
+
+	if v := verifyDetached(d, pushDetached(t, d, key, nil), testCheckOpts()); v.OK || v.Error == "" {
+		t.Errorf("want an explanation for not verifying, got %+v", v)
+	}
+}
+
+func TestVerifyDetachedChain(t *testing.T) {
+	repo := newTestRepo(t)
+	d := pushImage(t, repo.Tag("latest"))
+	root := newTestCA(t, nil)
+	intermediate := newTestCA(t, root)
+	leaf, key := intermediate.issue(t, &x509.Certificate{EmailAddresses: []string{"me@example.com"}})
+	co := testCheckOpts(root.cert)
+
+	// The intermediate isn't in the trust root, so it has to come from the
+	// chain annotation.
+	s := pushDetached(t, d, key, map[string]string{"dev.sigstore.cosign/certificate": certPEM(leaf)})
+	if v := verifyDetached(d, s, co); v.OK {
+		t.Error("verified without the intermediate")
+	}
+	s = pushDetached(t, d, key, map[string]string{
+		"dev.sigstore.cosign/certificate": certPEM(leaf),
+		"dev.sigstore.cosign/chain":       certPEM(intermediate.cert),
+	})
+	if v := verifyDetached(d, s, co); !v.OK {
+		t.Errorf("didn't verify with the chain: %s", v.Error)
+	}
+	if co.IntermediateCerts != nil {
+		t.Error("the chain leaked into the shared trust root")
+	}
+}
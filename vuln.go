@@ -0,0 +1,157 @@
+// Copyright 2023 The oci.fyi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	// Produced by `cosign attest --type vuln`. The scanner result is the raw
+	// output of the scanner (e.g. Grype or Trivy JSON).
+	predicateCosignVuln = "https://cosign.sigstore.dev/attestation/vuln/v1"
+	// https://github.com/in-toto/attestation/blob/main/spec/predicates/vulns_02.md
+	predicateInTotoVulns = "https://in-toto.io/attestation/vulns/v0.1"
+)
+
+// severities is the display order of vulnerability severities. Anything not
+// in this list is counted as "unknown".
+var severities = []string{"critical", "high", "medium", "low", "negligible", "unknown"}
+
+// scanSummary is a summary of a vulnerability scan attestation.
+type scanSummary struct {
+	Scanner string
+	// Counts is the number of vulnerabilities found, keyed by lowercase
+	// severity.
+	Counts map[string]int
+}
+
+// Total returns the total number of vulnerabilities found.
+func (s *scanSummary) Total() int {
+	n := 0
+	for _, c := range s.Counts {
+		n += c
+	}
+	return n
+}
+
+// String renders the counts in severity order, e.g. "1 critical, 3 high".
+func (s *scanSummary) String() string {
+	if s.Total() == 0 {
+		return "no vulnerabilities"
+	}
+	var out []string
+	for _, sev := range severities {
+		if c := s.Counts[sev]; c > 0 {
+			out = append(out, fmt.Sprintf("%d %s", c, sev))
+		}
+	}
+	return strings.Join(out, ", ")
+}
+
+func isScanResult(predicateType string) bool {
+	return predicateType == predicateCosignVuln || predicateType == predicateInTotoVulns
+}
+
+// parseScanResult summarizes the in-toto statement of a vulnerability scan
+// attestation. Grype, Trivy and in-toto vulns result shapes are understood.
+func parseScanResult(body []byte) (*scanSummary, error) {
+	var stmt struct {
+		Predicate struct {
+			Scanner struct {
+				URI     string          `json:"uri"`
+				Version string          `json:"version"`
+				Result  json.RawMessage `json:"result"`
+			} `json:"scanner"`
+		} `json:"predicate"`
+	}
+	if err := json.Unmarshal(body, &stmt); err != nil {
+		return nil, fmt.Errorf("error decoding scan predicate: %w", err)
+	}
+	scanner := stmt.Predicate.Scanner
+	out := &scanSummary{
+		Scanner: strings.TrimSpace(scanner.URI + " " + scanner.Version),
+		Counts:  map[string]int{},
+	}
+	if len(scanner.Result) == 0 || string(scanner.Result) == "null" {
+		return out, nil
+	}
+
+	var found []string
+	switch scanner.Result[0] {
+	case '[':
+		// in-toto vulns: [{"id": ..., "severity": [{"method": ..., "score": ...}]}]
+		var result []struct {
+			Severity []struct {
+				Score string `json:"score"`
+			} `json:"severity"`
+		}
+		if err := json.Unmarshal(scanner.Result, &result); err != nil {
+			return nil, fmt.Errorf("error decoding scan result: %w", err)
+		}
+		for _, r := range result {
+			sev := ""
+			if len(r.Severity) > 0 {
+				sev = r.Severity[0].Score
+			}
+			found = append(found, sev)
+		}
+	case '{':
+		var result struct {
+			// Grype
+			Matches []struct {
+				Vulnerability struct {
+					Severity string `json:"severity"`
+				} `json:"vulnerability"`
+			} `json:"matches"`
+			// Trivy
+			Results []struct {
+				Vulnerabilities []struct {
+					Severity string `json:"Severity"`
+				} `json:"Vulnerabilities"`
+			} `json:"Results"`
+		}
+		if err := json.Unmarshal(scanner.Result, &result); err != nil {
+			return nil, fmt.Errorf("error decoding scan result: %w", err)
+		}
+		for _, m := range result.Matches {
+			found = append(found, m.Vulnerability.Severity)
+		}
+		for _, r := range result.Results {
+			for _, v := range r.Vulnerabilities {
+				found = append(found, v.Severity)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown scan result format")
+	}
+
+	for _, sev := range found {
+		out.Counts[normalizeSeverity(sev)]++
+	}
+	return out, nil
+}
+
+func normalizeSeverity(sev string) string {
+	sev = strings.ToLower(sev)
+	for _, s := range severities {
+		if s == sev {
+			return s
+		}
+	}
+	return "unknown"
+}